@@ -34,6 +34,9 @@ type TokenResponse struct {
 }
 
 func getChoices(result TriviaResult) []*models.Answer {
+	if result.Type == models.TrueFalse {
+		return models.TrueFalseChoices(result.CorrectAnswer == "True")
+	}
 	choices := []*models.Answer{}
 	correctIndex, _ := randomInt(len(result.IncorrectAnswers))
 	j := 0
@@ -103,16 +106,6 @@ func main() {
 	}
 	defer pool.Close()
 	categories := map[string]int{}
-	rows, err := pool.Query(context.Background(), "SELECT id, name FROM categories")
-	if err != nil {
-		fail(err)
-	}
-	for rows.Next() {
-		var id int
-		var name string
-		rows.Scan(&id, &name)
-		categories[name] = id
-	}
 	res := &TriviaResponse{}
 	token, err := getToken()
 	if err != nil {
@@ -133,23 +126,22 @@ func main() {
 			if err == nil {
 				continue
 			}
-			q := models.Question{Text: text, Difficulty: r.Difficulty}
+			q := models.Question{Text: text, Type: models.MultipleChoice, Difficulty: r.Difficulty}
+			if r.Type == models.TrueFalse {
+				q.Type = models.TrueFalse
+			}
 			q.Choices = getChoices(r)
 			err := q.Create(pool)
 			if err != nil {
 				fmt.Println(err.Error())
 				continue
 			}
-			categoryId, ok := categories[r.Category]
+			category := html.UnescapeString(r.Category)
+			categoryId, ok := categories[category]
 			if !ok {
-				row := pool.QueryRow(
-					context.Background(),
-					"INSERT INTO categories (name) VALUES ($1) RETURNING id",
-					r.Category,
-				)
-				err := row.Scan(&categoryId)
+				categoryId, err = models.EnsureCategory(pool, category)
 				if err == nil {
-					categories[r.Category] = categoryId
+					categories[category] = categoryId
 				}
 			}
 			_, err = pool.Exec(
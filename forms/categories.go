@@ -0,0 +1,95 @@
+package forms
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"trivia/models"
+
+	"github.com/gorilla/csrf"
+)
+
+type CategoryForm struct {
+	Request    *http.Request
+	Errors     map[string][]error
+	Model      *models.Category
+	Categories []*models.Category
+	CsrfField  template.HTML
+}
+
+func NewCategoryForm(r *http.Request, m *models.Category) CategoryForm {
+	f := CategoryForm{Request: r, Model: m, Errors: make(map[string][]error)}
+	if f.Model == nil {
+		f.Model = &models.Category{}
+	}
+	categories, err := models.GetCategories()
+	if err == nil {
+		f.Categories = categories
+	}
+	f.CsrfField = csrf.TemplateField(r)
+	return f
+}
+
+// ParentChoices returns the categories the model may be filed under: any top
+// level category other than itself.
+func (f CategoryForm) ParentChoices() []*models.Category {
+	parents := []*models.Category{}
+	for _, c := range f.Categories {
+		if c.ParentId == 0 && c.Id != f.Model.Id {
+			parents = append(parents, c)
+		}
+	}
+	return parents
+}
+
+func (f *CategoryForm) IsValid() bool {
+	f.Request.ParseForm()
+	name := strings.TrimSpace(f.Request.Form.Get("name"))
+	if name == "" {
+		f.Errors["name"] = []error{errors.New("this field is required")}
+	} else if len(name) > 255 {
+		f.Errors["name"] = []error{errors.New("name must be at most 255 characters")}
+	} else {
+		f.Model.Name = name
+	}
+	parentId, _ := strconv.Atoi(f.Request.Form.Get("parent"))
+	if parentId != 0 {
+		valid := false
+		for _, c := range f.ParentChoices() {
+			if c.Id == parentId {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			f.Errors["parent"] = []error{errors.New("invalid parent category")}
+		} else if f.Model.Id != 0 {
+			hasChildren, err := f.Model.HasChildren()
+			if err != nil {
+				f.Errors["_nonFieldErrors"] = []error{err}
+			} else if hasChildren {
+				f.Errors["parent"] = []error{errors.New("a category with subcategories cannot have a parent")}
+			}
+		}
+	}
+	f.Model.ParentId = parentId
+	return len(f.Errors) == 0
+}
+
+func (f *CategoryForm) Save() error {
+	if f.Model.Id != 0 {
+		return f.Model.Update()
+	}
+	return f.Model.Create()
+}
+
+func (f *CategoryForm) Process() {
+	if f.IsValid() {
+		err := f.Save()
+		if err != nil {
+			f.Errors["_nonFieldErrors"] = []error{err}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package forms
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"trivia/models"
+
+	"github.com/gorilla/csrf"
+)
+
+const MaxNameLength = 50
+
+// LeaderboardForm adds a game to the leaderboard. With a Player the entry
+// goes under their username and any submitted name is ignored.
+type LeaderboardForm struct {
+	Request   *http.Request
+	Errors    map[string][]error
+	Model     *models.LeaderboardEntry
+	Player    *models.Player
+	CsrfField template.HTML
+}
+
+func NewLeaderboardForm(r *http.Request, m *models.LeaderboardEntry, player *models.Player) LeaderboardForm {
+	f := LeaderboardForm{Request: r, Model: m, Player: player, Errors: make(map[string][]error)}
+	if player != nil {
+		f.Model.Name = player.Username
+	}
+	f.CsrfField = csrf.TemplateField(r)
+	return f
+}
+
+func (f *LeaderboardForm) IsValid() bool {
+	f.Request.ParseForm()
+	name := strings.TrimSpace(f.Request.Form.Get("name"))
+	if f.Player != nil {
+		f.Model.Name = f.Player.Username
+	} else if name == "" {
+		f.Errors["name"] = []error{errors.New("this field is required")}
+	} else if len([]rune(name)) > MaxNameLength {
+		f.Errors["name"] = []error{errors.New("name must be at most 50 characters")}
+	} else {
+		f.Model.Name = name
+	}
+	return len(f.Errors) == 0
+}
+
+func (f *LeaderboardForm) Save() error {
+	return f.Model.Create()
+}
+
+func (f *LeaderboardForm) Process() {
+	if f.IsValid() {
+		err := f.Save()
+		if err != nil {
+			f.Errors["_nonFieldErrors"] = []error{err}
+		}
+	}
+}
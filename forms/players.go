@@ -0,0 +1,71 @@
+package forms
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"trivia/models"
+
+	"github.com/gorilla/csrf"
+)
+
+const (
+	MaxUsernameLength = 50
+	MinPasswordLength = 8
+)
+
+// PlayerForm signs a player up or, with Signup false, logs them in, in which
+// case only the username and password are required.
+type PlayerForm struct {
+	Request   *http.Request
+	Errors    map[string][]error
+	Model     *models.Player
+	Signup    bool
+	CsrfField template.HTML
+}
+
+func NewPlayerForm(r *http.Request, m *models.Player, signup bool) PlayerForm {
+	f := PlayerForm{Request: r, Model: m, Signup: signup, Errors: make(map[string][]error)}
+	if f.Model == nil {
+		f.Model = &models.Player{}
+	}
+	f.CsrfField = csrf.TemplateField(r)
+	return f
+}
+
+func (f *PlayerForm) IsValid() bool {
+	f.Request.ParseForm()
+	username := strings.TrimSpace(f.Request.Form.Get("username"))
+	password := f.Request.Form.Get("password")
+	if username == "" {
+		f.Errors["username"] = []error{errors.New("this field is required")}
+	} else if f.Signup && len([]rune(username)) > MaxUsernameLength {
+		f.Errors["username"] = []error{errors.New("username must be at most 50 characters")}
+	} else {
+		f.Model.Username = username
+	}
+	if password == "" {
+		f.Errors["password"] = []error{errors.New("this field is required")}
+	} else if f.Signup && len(password) < MinPasswordLength {
+		f.Errors["password"] = []error{errors.New("password must be at least 8 characters")}
+	} else if f.Signup && password != f.Request.Form.Get("confirm_password") {
+		f.Errors["confirm_password"] = []error{errors.New("passwords do not match")}
+	} else {
+		f.Model.Password = password
+	}
+	return len(f.Errors) == 0
+}
+
+func (f *PlayerForm) Save() error {
+	return f.Model.Create()
+}
+
+func (f *PlayerForm) Process() {
+	if f.IsValid() {
+		err := f.Save()
+		if err != nil {
+			f.Errors["_nonFieldErrors"] = []error{err}
+		}
+	}
+}
@@ -3,21 +3,57 @@ package forms
 import (
 	"fmt"
 	"html/template"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"trivia/models"
+	"trivia/storage"
 
 	"github.com/bgaudino/godino"
 	"github.com/gorilla/csrf"
 )
 
+// The number of choices a question may have.
+const (
+	MinChoices = 2
+	MaxChoices = 6
+)
+
+// MaxImageSize is the largest image upload accepted, in bytes.
+const MaxImageSize = 5 << 20
+
+// imageTypes maps the accepted image content types to file extensions.
+var imageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
 type QuestionForm struct {
 	Request    *http.Request
 	Errors     map[string][]error
 	Model      *models.Question
 	Categories []*models.Category
 	CsrfField  template.HTML
+	// ChoiceKeys identify the choice rows while they are added and removed,
+	// so that an image picked for a row stays with it.
+	ChoiceKeys []string
+	uploads    []*upload
+}
+
+// upload is a validated image waiting to be stored once the whole form is
+// valid. Its storage key replaces the one in target.
+type upload struct {
+	header   *multipart.FileHeader
+	ext      string
+	target   *string
+	previous string
+	stored   string
 }
 
 func NewQuestionForm(r *http.Request, m *models.Question) QuestionForm {
@@ -36,36 +72,201 @@ func NewQuestionForm(r *http.Request, m *models.Question) QuestionForm {
 }
 
 func (f *QuestionForm) AddEmptyQuestions() {
-	for len(f.Model.Choices) < 4 {
+	for len(f.Model.Choices) < MinChoices {
 		f.Model.Choices = append(f.Model.Choices, &models.Answer{})
 	}
 }
 
+// parseChoices reads the submitted choice rows in order, including blank
+// ones, along with the key of each row.
+func (f *QuestionForm) parseChoices() ([]*models.Answer, []string) {
+	correctIndexes := godino.NewSet[int]()
+	for _, c := range f.Request.Form["correct"] {
+		i, err := strconv.Atoi(c)
+		if err == nil {
+			correctIndexes.Add(i)
+		}
+	}
+	removedImages := godino.NewSet(f.Request.Form["remove_choice_image"]...)
+	choiceIds := f.Request.Form["choice_ids"]
+	choiceImages := f.Request.Form["choice_images"]
+	choiceKeys := f.Request.Form["choice_keys"]
+	choices := []*models.Answer{}
+	keys := []string{}
+	for idx, c := range f.Request.Form["choices"] {
+		choice := &models.Answer{Text: strings.TrimSpace(c), IsCorrect: correctIndexes.Has(idx)}
+		if idx < len(choiceIds) {
+			choice.Id, _ = strconv.Atoi(choiceIds[idx])
+		}
+		if idx < len(choiceImages) && !removedImages.Has(strconv.Itoa(idx)) {
+			choice.Image = choiceImages[idx]
+		}
+		if idx < len(choiceKeys) && choiceKeys[idx] != "" {
+			keys = append(keys, choiceKeys[idx])
+		} else {
+			keys = append(keys, unusedKey(keys))
+		}
+		choices = append(choices, choice)
+	}
+	return choices, keys
+}
+
+// unusedKey returns the smallest number, as a string, that isn't one of keys.
+func unusedKey(keys []string) string {
+	used := godino.NewSet(keys...)
+	for n := len(keys); ; n++ {
+		if !used.Has(strconv.Itoa(n)) {
+			return strconv.Itoa(n)
+		}
+	}
+}
+
+// ChoiceKey returns the key of the choice row at index i.
+func (f QuestionForm) ChoiceKey(i int) string {
+	if i < len(f.ChoiceKeys) {
+		return f.ChoiceKeys[i]
+	}
+	return strconv.Itoa(i)
+}
+
+// parseRequest parses the submitted form, which is multipart when it
+// carries image uploads.
+func (f *QuestionForm) parseRequest() {
+	err := f.Request.ParseMultipartForm(MaxImageSize)
+	if err != nil && err != http.ErrNotMultipart {
+		f.Errors["_nonFieldErrors"] = []error{err}
+	}
+}
+
+// checkImage validates the image uploaded in the named field, if any, and
+// queues it to be stored into target by saveImages.
+func (f *QuestionForm) checkImage(field string, target *string) error {
+	if f.Request.MultipartForm == nil || len(f.Request.MultipartForm.File[field]) == 0 {
+		return nil
+	}
+	header := f.Request.MultipartForm.File[field][0]
+	if header.Size > MaxImageSize {
+		return fmt.Errorf("images must be at most %v MB", MaxImageSize>>20)
+	}
+	file, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	ext, ok := imageTypes[http.DetectContentType(head[:n])]
+	if !ok {
+		return fmt.Errorf("images must be PNG, JPEG, GIF or WebP")
+	}
+	f.uploads = append(f.uploads, &upload{header: header, ext: ext, target: target})
+	return nil
+}
+
+// saveImages stores the queued uploads. It is only called once the form is
+// valid, so that rejected submissions leave nothing behind in storage.
+func (f *QuestionForm) saveImages() error {
+	for _, u := range f.uploads {
+		file, err := u.header.Open()
+		if err != nil {
+			f.discardImages()
+			return err
+		}
+		key, err := storage.Default.Save(file, u.ext)
+		file.Close()
+		if err != nil {
+			f.discardImages()
+			return err
+		}
+		u.stored, u.previous, *u.target = key, *u.target, key
+	}
+	return nil
+}
+
+// discardImages deletes the uploads stored by saveImages, restoring the
+// images they replaced.
+func (f *QuestionForm) discardImages() {
+	for _, u := range f.uploads {
+		if u.stored == "" {
+			continue
+		}
+		err := storage.Default.Delete(u.stored)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+		*u.target, u.stored = u.previous, ""
+	}
+}
+
+// EditChoices rebuilds the form's choice rows from the submitted form, adding
+// a blank row or removing the row at the given index, within the
+// MinChoices-MaxChoices range.
+func (f *QuestionForm) EditChoices(action string, index int) {
+	f.parseRequest()
+	choices, keys := f.parseChoices()
+	switch action {
+	case "add":
+		if len(choices) < MaxChoices {
+			choices = append(choices, &models.Answer{})
+			keys = append(keys, unusedKey(keys))
+		}
+	case "remove":
+		if len(choices) > MinChoices && index >= 0 && index < len(choices) {
+			choices = append(choices[:index], choices[index+1:]...)
+			keys = append(keys[:index], keys[index+1:]...)
+		}
+	}
+	f.Model.Choices = choices
+	f.AddEmptyQuestions()
+	for len(keys) < len(f.Model.Choices) {
+		keys = append(keys, unusedKey(keys))
+	}
+	f.ChoiceKeys = keys
+}
+
+func (f QuestionForm) CanAddChoice() bool {
+	return len(f.Model.Choices) < MaxChoices
+}
+
+func (f QuestionForm) CanRemoveChoice() bool {
+	return len(f.Model.Choices) > MinChoices
+}
+
 func (f *QuestionForm) IsValid() bool {
-	f.Request.ParseForm()
+	f.parseRequest()
 	q := strings.TrimSpace(f.Request.Form.Get("question"))
 	if q == "" {
 		e := f.Errors["question"]
 		e = append(e, fmt.Errorf("this field is required"))
 		f.Errors["question"] = e
 	}
-	cat, err := strconv.Atoi(f.Request.Form.Get("category"))
-	if err != nil {
-		f.Errors["category"] = []error{fmt.Errorf("invalid category")}
-	}
-	cIsValid := false
-	var category models.Category
-	for _, c := range f.Categories {
-		if cat == c.Id {
-			category = *c
-			cIsValid = true
+	categories := []*models.Category{}
+	categoryIds := godino.NewSet[int]()
+	for _, value := range f.Request.Form["category"] {
+		id, err := strconv.Atoi(value)
+		if categoryIds.Has(id) {
+			continue
+		}
+		categoryIds.Add(id)
+		var category *models.Category
+		for _, c := range f.Categories {
+			if err == nil && id == c.Id {
+				category = c
+				break
+			}
+		}
+		if category == nil {
+			f.Errors["category"] = []error{fmt.Errorf("invalid category")}
 			break
 		}
+		categories = append(categories, category)
 	}
-	if !cIsValid {
-		f.Errors["category"] = []error{fmt.Errorf("invalid category")}
-	} else {
-		f.Model.Categories = append(f.Model.Categories, &category)
+	f.Model.Categories = categories
+	if len(categories) == 0 && len(f.Errors["category"]) == 0 {
+		f.Errors["category"] = []error{fmt.Errorf("at least one category is required")}
 	}
 	d := f.Request.Form.Get("difficulty")
 	if d != "easy" && d != "medium" && d != "hard" {
@@ -76,45 +277,183 @@ func (f *QuestionForm) IsValid() bool {
 		f.Model.Difficulty = d
 	}
 	f.Model.Text = q
-	correct := f.Request.Form["correct"]
-	correctIndexes := godino.NewSet[int]()
-	for _, c := range correct {
-		i, err := strconv.Atoi(c)
-		if err == nil {
-			correctIndexes.Add(i)
+	f.Model.Tags = []*models.Tag{}
+	for _, t := range models.ParseTags(f.Request.Form.Get("tags")) {
+		if len(t) > 255 {
+			f.Errors["tags"] = []error{fmt.Errorf("tags must be at most 255 characters")}
+			break
 		}
+		f.Model.Tags = append(f.Model.Tags, &models.Tag{Name: t})
 	}
+	f.Model.Image = f.Request.Form.Get("image_key")
+	if f.Request.Form.Get("remove_image") != "" {
+		f.Model.Image = ""
+	}
+	err := f.checkImage("image", &f.Model.Image)
+	if err != nil {
+		f.Errors["image"] = []error{err}
+	}
+	t := f.Request.Form.Get("type")
+	switch t {
+	case models.TrueFalse:
+		f.Model.Type = t
+		f.validateTrueFalse()
+	case models.FreeText:
+		f.Model.Type = t
+		f.validateFreeText()
+	case models.SelectAll:
+		f.Model.Type = t
+		f.validateChoices()
+	case models.MultipleChoice, "":
+		f.Model.Type = models.MultipleChoice
+		f.validateChoices()
+	default:
+		f.Errors["type"] = []error{fmt.Errorf("invalid question type")}
+	}
+	f.Model.PartialCredit = f.Model.Type == models.SelectAll && f.Request.Form.Get("partial_credit") != ""
+	f.Model.Explanation = strings.TrimSpace(f.Request.Form.Get("explanation"))
+	source := strings.TrimSpace(f.Request.Form.Get("source_url"))
+	if source != "" {
+		u, err := url.Parse(source)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			f.Errors["source_url"] = []error{fmt.Errorf("enter a valid http or https URL")}
+		} else if len(source) > 2048 {
+			f.Errors["source_url"] = []error{fmt.Errorf("URL must be at most 2048 characters")}
+		}
+	}
+	f.Model.SourceUrl = source
+	if len(f.Errors) == 0 {
+		err := f.saveImages()
+		if err != nil {
+			f.Errors["_nonFieldErrors"] = []error{err}
+		}
+	}
+	if len(f.Errors) > 0 {
+		f.AddEmptyQuestions()
+		return false
+	}
+	return true
+}
+
+func (f *QuestionForm) validateChoices() {
 	correctCount := 0
 	ch := []*models.Answer{}
-	for idx, c := range f.Request.Form["choices"] {
-		c = strings.TrimSpace(c)
-		if c != "" {
-			choice := &models.Answer{Text: c}
-			if correctIndexes.Has(idx) {
-				choice.IsCorrect = true
-				correctCount++
-			}
-			ch = append(ch, choice)
+	choices, keys := f.parseChoices()
+	for idx, c := range choices {
+		if c.Text == "" {
+			continue
 		}
+		err := f.checkImage("choice_image-"+keys[idx], &c.Image)
+		if err != nil {
+			f.Errors["choices"] = append(f.Errors["choices"], fmt.Errorf("choice %v: %w", idx+1, err))
+		}
+		if c.IsCorrect {
+			correctCount++
+		}
+		ch = append(ch, c)
 	}
 	f.Model.Choices = ch
-	if len(f.Model.Choices) == 0 {
+	if len(f.Model.Choices) < MinChoices {
+		e := f.Errors["choices"]
+		e = append(e, fmt.Errorf("at least %v choices are required", MinChoices))
+		f.Errors["choices"] = e
+	} else if len(f.Model.Choices) > MaxChoices {
+		e := f.Errors["choices"]
+		e = append(e, fmt.Errorf("at most %v choices are allowed", MaxChoices))
+		f.Errors["choices"] = e
+	} else if f.Model.Type == models.SelectAll && correctCount == 0 {
 		e := f.Errors["choices"]
-		e = append(e, fmt.Errorf("at least one choice is required"))
+		e = append(e, fmt.Errorf("at least one correct choice is required"))
 		f.Errors["choices"] = e
-	} else if correctCount != 1 {
+	} else if f.Model.Type != models.SelectAll && correctCount != 1 {
 		e := f.Errors["choices"]
 		e = append(e, fmt.Errorf("exactly one correct choice is required"))
 		f.Errors["choices"] = e
 	}
-	if len(f.Errors) > 0 {
-		f.AddEmptyQuestions()
-		return false
+}
+
+// validateTrueFalse replaces the choices with "True" and "False", keeping the
+// ids of any existing choices with the same text.
+func (f *QuestionForm) validateTrueFalse() {
+	answer := f.Request.Form.Get("boolean_answer")
+	if answer != "true" && answer != "false" {
+		f.Errors["boolean_answer"] = []error{fmt.Errorf("choose whether the statement is true or false")}
+		return
 	}
-	return true
+	choices := models.TrueFalseChoices(answer == "true")
+	for _, c := range choices {
+		for _, existing := range f.Model.Choices {
+			if existing.Id != 0 && existing.Text == c.Text {
+				c.Id = existing.Id
+			}
+		}
+	}
+	f.Model.Choices = choices
+}
+
+// validateFreeText turns each line of accepted_answers into a correct choice,
+// keeping the ids of any existing choices with the same text.
+func (f *QuestionForm) validateFreeText() {
+	seen := godino.NewSet[string]()
+	choices := []*models.Answer{}
+	for _, line := range strings.Split(f.Request.Form.Get("accepted_answers"), "\n") {
+		line = strings.TrimSpace(line)
+		normalized := models.NormalizeAnswer(line)
+		if normalized == "" || seen.Has(normalized) {
+			continue
+		}
+		seen.Add(normalized)
+		if len(line) > 255 {
+			f.Errors["accepted_answers"] = []error{fmt.Errorf("answers must be at most 255 characters")}
+			return
+		}
+		choice := &models.Answer{Text: line, IsCorrect: true}
+		for _, existing := range f.Model.Choices {
+			if existing.Id != 0 && existing.Text == line {
+				choice.Id = existing.Id
+			}
+		}
+		choices = append(choices, choice)
+	}
+	if len(choices) == 0 {
+		f.Errors["accepted_answers"] = []error{fmt.Errorf("at least one accepted answer is required")}
+		return
+	}
+	f.Model.Choices = choices
+}
+
+// AcceptedAnswers returns the accepted answers of a free text question, one
+// per line.
+func (f QuestionForm) AcceptedAnswers() string {
+	if f.Model.Type != models.FreeText {
+		return ""
+	}
+	return strings.Join(f.Model.AcceptedAnswers(), "\n")
+}
+
+// TagList returns the question's tags as a comma separated list.
+func (f QuestionForm) TagList() string {
+	return strings.Join(f.Model.TagNames(), ", ")
+}
+
+// BooleanAnswer returns "true" or "false" for a true/false question, or an
+// empty string if no answer has been chosen yet.
+func (f QuestionForm) BooleanAnswer() string {
+	if f.Model.Type != models.TrueFalse {
+		return ""
+	}
+	for _, c := range f.Model.Choices {
+		if c.IsCorrect {
+			return strings.ToLower(c.Text)
+		}
+	}
+	return ""
 }
 
 func (f *QuestionForm) Save() error {
+	if f.Model.Id != 0 {
+		return f.Model.Update(nil)
+	}
 	return f.Model.Create(nil)
 }
 
@@ -122,6 +461,7 @@ func (f *QuestionForm) Process() {
 	if f.IsValid() {
 		err := f.Save()
 		if err != nil {
+			f.discardImages()
 			f.Errors["_nonFieldErrors"] = []error{err}
 			f.AddEmptyQuestions()
 		}
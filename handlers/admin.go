@@ -1,8 +1,17 @@
 package handlers
 
 import (
+	"fmt"
+	"html/template"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"trivia/models"
+
+	"github.com/gorilla/csrf"
+	"github.com/jackc/pgx/v5"
 )
 
 func adminHandler(w http.ResponseWriter, r *http.Request) {
@@ -11,3 +20,141 @@ func adminHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 var AdminHandler = loginRequired(adminHandler)
+
+func adminQuestionsHandler(w http.ResponseWriter, r *http.Request) {
+	segments := pathSegments(r, "/admin/questions/")
+	if len(segments) == 0 {
+		questionListHandler(w, r, false)
+		return
+	}
+	if len(segments) == 1 && segments[0] == "trash" {
+		questionListHandler(w, r, true)
+		return
+	}
+	if len(segments) == 1 && segments[0] == "choices" {
+		choiceRowsHandler(w, r)
+		return
+	}
+	if len(segments) == 2 {
+		id, err := strconv.Atoi(segments[0])
+		if err == nil {
+			switch segments[1] {
+			case "edit":
+				questionEditHandler(w, r, id)
+				return
+			case "archive", "restore", "purge":
+				questionActionHandler(w, r, id, segments[1])
+				return
+			}
+		}
+	}
+	http.NotFound(w, r)
+}
+
+var AdminQuestionsHandler = loginRequired(adminQuestionsHandler)
+
+type QuestionListContext struct {
+	Page       *models.QuestionPage
+	Search     *models.QuestionSearch
+	Categories []*models.Category
+	CsrfField  template.HTML
+	path       string
+	query      url.Values
+}
+
+// PageURL returns the current listing URL pointed at page n.
+func (c QuestionListContext) PageURL(n int) string {
+	q := url.Values{}
+	for k, v := range c.query {
+		q[k] = v
+	}
+	q.Set("page", strconv.Itoa(n))
+	return c.path + "?" + q.Encode()
+}
+
+// SortURL returns the current listing URL sorted by column, flipping the
+// direction if it is already the sort column.
+func (c QuestionListContext) SortURL(column string) string {
+	q := url.Values{}
+	for k, v := range c.query {
+		q[k] = v
+	}
+	q.Del("page")
+	if c.Search.Sort == column {
+		q.Set("sort", "-"+column)
+	} else {
+		q.Set("sort", column)
+	}
+	return c.path + "?" + q.Encode()
+}
+
+func questionListHandler(w http.ResponseWriter, r *http.Request, archived bool) {
+	query := r.URL.Query()
+	search := models.QuestionSearch{
+		Text:     strings.TrimSpace(query.Get("q")),
+		Archived: archived,
+		Sort:     query.Get("sort"),
+	}
+	search.Category, _ = strconv.Atoi(query.Get("category"))
+	search.Page, _ = strconv.Atoi(query.Get("page"))
+	difficulty := query.Get("difficulty")
+	if difficulty == "easy" || difficulty == "medium" || difficulty == "hard" {
+		search.Difficulty = difficulty
+	}
+	page, err := models.SearchQuestions(&search)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	categories, err := models.GetCategories()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	Templates.ExecuteTemplate(w, "questions.html", QuestionListContext{
+		Page:       page,
+		Search:     &search,
+		Categories: categories,
+		CsrfField:  csrf.TemplateField(r),
+		path:       r.URL.Path,
+		query:      query,
+	})
+}
+
+func questionActionHandler(w http.ResponseWriter, r *http.Request, id int, action string) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	question := models.Question{Id: id}
+	var err error
+	switch action {
+	case "archive":
+		err = question.Archive()
+	case "restore":
+		err = question.Restore()
+	case "purge":
+		err = question.Purge()
+	}
+	if err == pgx.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err == models.ErrNotArchived {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if action == "archive" {
+		http.Redirect(w, r, "/admin/questions/", http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, "/admin/questions/trash/", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strconv"
+	"trivia/forms"
+	"trivia/models"
+)
+
+func adminCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	segments := pathSegments(r, "/admin/categories/")
+	if len(segments) == 0 {
+		categoryListHandler(w, r)
+		return
+	}
+	if len(segments) == 2 {
+		id, err := strconv.Atoi(segments[0])
+		if err == nil {
+			switch segments[1] {
+			case "edit":
+				categoryEditHandler(w, r, id)
+				return
+			case "merge":
+				categoryMergeHandler(w, r, id)
+				return
+			case "delete":
+				categoryDeleteHandler(w, r, id)
+				return
+			}
+		}
+	}
+	http.NotFound(w, r)
+}
+
+var AdminCategoriesHandler = loginRequired(adminCategoriesHandler)
+
+type CategoryListContext struct {
+	Categories []*models.Category
+	Form       forms.CategoryForm
+	CsrfField  template.HTML
+}
+
+func categoryListHandler(w http.ResponseWriter, r *http.Request) {
+	form := forms.NewCategoryForm(r, nil)
+	if r.Method == "POST" {
+		form.Process()
+		if len(form.Errors) == 0 {
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
+		}
+	}
+	categories, err := models.GetCategoriesWithCounts()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	Templates.ExecuteTemplate(w, "categories.html", CategoryListContext{
+		Categories: categories,
+		Form:       form,
+		CsrfField:  form.CsrfField,
+	})
+}
+
+// getCategoryOr404 looks up the category with the given id, writing an error
+// response and returning nil if it cannot be found.
+func getCategoryOr404(w http.ResponseWriter, r *http.Request, id int) *models.Category {
+	category, err := models.GetCategory(id)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return nil
+	}
+	if category == nil {
+		http.NotFound(w, r)
+	}
+	return category
+}
+
+func categoryEditHandler(w http.ResponseWriter, r *http.Request, id int) {
+	category := getCategoryOr404(w, r, id)
+	if category == nil {
+		return
+	}
+	form := forms.NewCategoryForm(r, category)
+	if r.Method == "POST" {
+		form.Process()
+		if len(form.Errors) == 0 {
+			http.Redirect(w, r, "/admin/categories/", http.StatusSeeOther)
+			return
+		}
+	}
+	Templates.ExecuteTemplate(w, "category_form.html", form)
+}
+
+func categoryMergeHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	category := getCategoryOr404(w, r, id)
+	if category == nil {
+		return
+	}
+	form := forms.NewCategoryForm(r, category)
+	targetId, _ := strconv.Atoi(r.FormValue("target"))
+	target, err := models.GetCategory(targetId)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if target == nil {
+		form.Errors["target"] = []error{fmt.Errorf("invalid category")}
+	} else {
+		err = category.MergeInto(target)
+		if err == nil {
+			http.Redirect(w, r, "/admin/categories/", http.StatusSeeOther)
+			return
+		}
+		form.Errors["target"] = []error{err}
+	}
+	Templates.ExecuteTemplate(w, "category_form.html", form)
+}
+
+func categoryDeleteHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	category := getCategoryOr404(w, r, id)
+	if category == nil {
+		return
+	}
+	err := category.Delete()
+	if err == nil {
+		http.Redirect(w, r, "/admin/categories/", http.StatusSeeOther)
+		return
+	}
+	form := forms.NewCategoryForm(r, category)
+	form.Errors["delete"] = []error{err}
+	Templates.ExecuteTemplate(w, "category_form.html", form)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"trivia/models"
+)
+
+type ChallengeContext struct {
+	Seed         string
+	ShareUrl     string
+	Games        []*models.Game
+	NumQuestions int
+	// Current is the token of the game being viewed, if any, so it can be
+	// picked out among the others.
+	Current string
+}
+
+// absoluteUrl turns a path into a full URL on this site, for links that are
+// shared elsewhere.
+func absoluteUrl(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+// getChallenge collects the finished games of the challenge that game belongs
+// to.
+func getChallenge(r *http.Request, game *models.Game) (*ChallengeContext, error) {
+	games, err := models.GetChallengeGames(game.Seed)
+	if err != nil {
+		return nil, err
+	}
+	return &ChallengeContext{
+		Seed:         game.Seed,
+		ShareUrl:     absoluteUrl(r, game.ChallengeUrl()),
+		Games:        games,
+		NumQuestions: game.NumQuestions(),
+		Current:      game.Token,
+	}, nil
+}
+
+// ChallengeHandler shows the scores to beat for the challenge at
+// /challenge/{seed}/ and starts a new game with its questions at
+// /challenge/{seed}/play/.
+func ChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	segments := pathSegments(r, "/challenge/")
+	if len(segments) == 0 || len(segments) > 2 || (len(segments) == 2 && segments[1] != "play") {
+		http.NotFound(w, r)
+		return
+	}
+	seed := segments[0]
+	if len(segments) == 2 {
+		game, err := models.NewChallenge(seed, playerId(w, r))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		if game == nil {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, game.Url(), http.StatusSeeOther)
+		return
+	}
+	games, err := models.GetChallengeGames(seed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if len(games) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	// Every game in a challenge has the same questions, so any of them will do
+	// for the count.
+	first, err := models.GetGame(games[0].Token)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	Templates.ExecuteTemplate(w, "challenge.html", ChallengeContext{
+		Seed:         seed,
+		ShareUrl:     absoluteUrl(r, first.ChallengeUrl()),
+		Games:        games,
+		NumQuestions: first.NumQuestions(),
+	})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"trivia/models"
+)
+
+type LeaderboardContext struct {
+	Entries    []*models.LeaderboardEntry
+	Filters    *models.LeaderboardFilters
+	Categories []*models.Category
+}
+
+// LeaderboardHandler shows the top scores of all time or this week, overall
+// or for a category or difficulty.
+func LeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filters := models.LeaderboardFilters{Weekly: query.Get("period") == "week", Limit: 50}
+	filters.Category, _ = strconv.Atoi(query.Get("category"))
+	difficulty := query.Get("difficulty")
+	if models.IsDifficulty(difficulty) || difficulty == "mixed" {
+		filters.Difficulty = difficulty
+	}
+	entries, err := models.GetLeaderboard(&filters)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	categories, err := models.GetCategoryTree()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	Templates.ExecuteTemplate(w, "leaderboard.html", LeaderboardContext{
+		Entries:    entries,
+		Filters:    &filters,
+		Categories: categories,
+	})
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"trivia/storage"
+)
+
+// MediaHandler serves uploaded images. Keys are never reused, so responses
+// can be cached indefinitely.
+func MediaHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/media/")
+	f, err := storage.Default.Open(key)
+	if errors.Is(err, storage.ErrInvalidKey) || errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, key, time.Time{}, f)
+}
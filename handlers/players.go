@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"trivia/forms"
+	"trivia/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/csrf"
+)
+
+// loggedInPlayer returns the player logged in to an account, or nil.
+func loggedInPlayer(r *http.Request) *models.Player {
+	s := models.GetPlayerSession(r)
+	if s == nil {
+		return nil
+	}
+	return s.Player
+}
+
+// currentPlayer returns the logged in player, or failing that the anonymous
+// player, or nil.
+func currentPlayer(r *http.Request) *models.Player {
+	if p := loggedInPlayer(r); p != nil {
+		return p
+	}
+	s := models.GetAnonymousSession(r)
+	if s == nil {
+		return nil
+	}
+	return s.Player
+}
+
+// ensurePlayer returns the current player, first making an anonymous one for
+// visitors who aren't yet known. It gives nil if that fails, so that the
+// visitor can still play.
+func ensurePlayer(w http.ResponseWriter, r *http.Request) *models.Player {
+	if p := currentPlayer(r); p != nil {
+		return p
+	}
+	p, err := models.NewAnonymousPlayer()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return nil
+	}
+	expiry := time.Now().UTC().Add(365 * 24 * time.Hour)
+	err = startSession(w, models.AnonymousPlayerCookie, p, expiry)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return nil
+	}
+	return p
+}
+
+// playerId returns the id of the current player, making an anonymous one if
+// needed, or zero.
+func playerId(w http.ResponseWriter, r *http.Request) int {
+	p := ensurePlayer(w, r)
+	if p == nil {
+		return 0
+	}
+	return p.Id
+}
+
+// startSession saves a session for the player and sets its cookie.
+func startSession(w http.ResponseWriter, cookie string, p *models.Player, expiry time.Time) error {
+	s := models.Session{
+		Token:  uuid.New().String(),
+		Expiry: expiry,
+		Player: p,
+	}
+	err := s.Save()
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookie,
+		Value:    s.Token,
+		Expires:  expiry,
+		Path:     "/",
+		HttpOnly: true,
+	})
+	return nil
+}
+
+// logInPlayer starts a session for the player, lasting a month, and moves
+// any history they had as an anonymous player to their account.
+func logInPlayer(w http.ResponseWriter, r *http.Request, p *models.Player) error {
+	if s := models.GetAnonymousSession(r); s != nil {
+		err := p.Adopt(s.Player)
+		if err != nil {
+			return err
+		}
+		http.SetCookie(w, &http.Cookie{Name: models.AnonymousPlayerCookie, Path: "/", MaxAge: -1})
+	}
+	return startSession(w, models.PlayerSessionCookie, p, time.Now().UTC().Add(30*24*time.Hour))
+}
+
+func SignupHandler(w http.ResponseWriter, r *http.Request) {
+	if loggedInPlayer(r) != nil {
+		http.Redirect(w, r, "/account/", http.StatusSeeOther)
+		return
+	}
+	form := forms.NewPlayerForm(r, nil, true)
+	if r.Method == "POST" {
+		form.Process()
+		if len(form.Errors) == 0 {
+			err := logInPlayer(w, r, form.Model)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				http.Error(w, "Something went wrong", http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, "/account/", http.StatusSeeOther)
+			return
+		}
+	}
+	Templates.ExecuteTemplate(w, "player_form.html", form)
+}
+
+func PlayerLogin(w http.ResponseWriter, r *http.Request) {
+	if loggedInPlayer(r) != nil {
+		http.Redirect(w, r, "/account/", http.StatusSeeOther)
+		return
+	}
+	form := forms.NewPlayerForm(r, nil, false)
+	if r.Method == "POST" && form.IsValid() {
+		player, err := models.GetPlayer(form.Model.Username)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		if player == nil || !player.CheckPassword(form.Model.Password) {
+			form.Errors["_nonFieldErrors"] = []error{errors.New("invalid username or password")}
+		} else {
+			err = logInPlayer(w, r, player)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				http.Error(w, "Something went wrong", http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, "/account/", http.StatusSeeOther)
+			return
+		}
+	}
+	Templates.ExecuteTemplate(w, "player_form.html", form)
+}
+
+func PlayerLogout(w http.ResponseWriter, r *http.Request) {
+	s := models.GetPlayerSession(r)
+	if s != nil {
+		s.Delete()
+	}
+	http.SetCookie(w, &http.Cookie{Name: models.PlayerSessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+type AccountContext struct {
+	Player    *models.Player
+	Stats     *models.PlayerStats
+	History   []*models.GameSummary
+	CsrfField template.HTML
+}
+
+// AccountHandler shows the player's stats and recent games, from where
+// unfinished ones can be resumed. Anonymous players are asked to sign up to
+// keep them.
+func AccountHandler(w http.ResponseWriter, r *http.Request) {
+	player := currentPlayer(r)
+	if player == nil {
+		http.Redirect(w, r, "/login/", http.StatusSeeOther)
+		return
+	}
+	segments := pathSegments(r, "/account/")
+	if len(segments) == 1 && segments[0] == "reset-seen" {
+		resetSeenHandler(w, r, player)
+		return
+	}
+	if len(segments) > 0 {
+		http.NotFound(w, r)
+		return
+	}
+	stats, err := player.Stats()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	history, err := player.History(50)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	Templates.ExecuteTemplate(w, "account.html", AccountContext{
+		Player:    player,
+		Stats:     stats,
+		History:   history,
+		CsrfField: csrf.TemplateField(r),
+	})
+}
+
+// resetSeenHandler lets the player see questions they've already had again,
+// then sends them on to next, if it's a path on this site.
+func resetSeenHandler(w http.ResponseWriter, r *http.Request, player *models.Player) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	err := player.ResetSeen()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	next := r.PostFormValue("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+		next = "/account/"
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
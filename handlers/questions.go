@@ -1,13 +1,19 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"trivia/forms"
 	"trivia/models"
+
+	"github.com/gorilla/csrf"
 )
 
 var Templates *template.Template
@@ -18,25 +24,80 @@ func GetTemplates() *template.Template {
 		"inc": func(i int) int {
 			return i + 1
 		},
+		"dec": func(i int) int {
+			return i - 1
+		},
 	})
 	template.Must(t.ParseGlob(dir + "*.html"))
 	template.Must(t.ParseGlob(dir + "partials/*.html"))
 	return t
 }
 
+// pathSegments splits the part of the request path following prefix into its
+// non-empty segments, e.g. "/admin/questions/1/edit/" with prefix
+// "/admin/questions/" gives ["1", "edit"].
+func pathSegments(r *http.Request, prefix string) []string {
+	segments := []string{}
+	for _, s := range strings.Split(strings.TrimPrefix(r.URL.Path, prefix), "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+type OptionsContext struct {
+	Player     *models.Player
+	Categories []*models.Category
+	Tags       []*models.Tag
+	TimeLimits []TimeLimit
+}
+
+type TimeLimit struct {
+	Difficulty string
+	Seconds    int
+}
+
 func OptionsHandler(w http.ResponseWriter, r *http.Request) {
-	categories, err := models.GetCategories()
+	categories, err := models.GetCategoryTree()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	tags, err := models.GetTags()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	limits := []TimeLimit{}
+	for _, d := range models.Difficulties {
+		limits = append(limits, TimeLimit{Difficulty: d, Seconds: int(models.TimeLimits[d].Seconds())})
+	}
+	Templates.ExecuteTemplate(w, "options.html", OptionsContext{
+		Player:     ensurePlayer(w, r),
+		Categories: categories,
+		Tags:       tags,
+		TimeLimits: limits,
+	})
+}
+
+// parseIds converts query parameter values to ids, skipping any that aren't
+// numbers.
+func parseIds(values []string) []int {
+	ids := []int{}
+	for _, v := range values {
+		id, err := strconv.Atoi(v)
+		if err == nil && id > 0 {
+			ids = append(ids, id)
+		}
 	}
-	Templates.ExecuteTemplate(w, "options.html", categories)
+	return ids
 }
 
-func PlayHandler(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
-	categoryParam := query.Get("category")
-	categoryId, _ := strconv.Atoi(categoryParam)
+// parseFilters reads the game options chosen on the options page.
+func parseFilters(query url.Values) models.QuestionFilters {
 	count := 10
 	countParam := query.Get("count")
 	n, err := strconv.Atoi(countParam)
@@ -44,62 +105,343 @@ func PlayHandler(w http.ResponseWriter, r *http.Request) {
 		count = n
 	}
 	var difficulty string
+	var mix map[string]int
 	difficultyParam := query.Get("difficulty")
-	if difficultyParam == "easy" || difficultyParam == "medium" || difficultyParam == "hard" {
+	if models.IsDifficulty(difficultyParam) {
 		difficulty = difficultyParam
+	} else if difficultyParam == "mixed" {
+		mix = map[string]int{}
+		total := 0
+		for _, d := range models.Difficulties {
+			n, err := strconv.Atoi(query.Get(d))
+			if err == nil && n > 0 && total+n <= 20 {
+				mix[d] = n
+				total += n
+			}
+		}
+	}
+	return models.QuestionFilters{
+		Mix:               mix,
+		Count:             count,
+		Categories:        parseIds(query["category"]),
+		ExcludeCategories: parseIds(query["exclude"]),
+		Difficulty:        difficulty,
+		Tags:              models.ParseTags(query.Get("tags")),
+	}
+}
+
+// PlayHandler starts a new game with the options in the query string and
+// redirects to it, plays the game at /play/{token}/ or reviews it once
+// finished at /play/{token}/results/.
+func PlayHandler(w http.ResponseWriter, r *http.Request) {
+	segments := pathSegments(r, "/play/")
+	if len(segments) == 0 {
+		filters := parseFilters(r.URL.Query())
+		game, err := models.NewGame(&filters, r.URL.RawQuery, r.URL.Query().Get("timed") != "", playerId(w, r))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, game.Url(), http.StatusSeeOther)
+		return
+	}
+	if len(segments) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+	game, err := models.GetGame(segments[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if game == nil {
+		http.NotFound(w, r)
+		return
+	}
+	context := PlayContext{Game: game, CsrfToken: csrf.Token(r), CsrfField: csrf.TemplateField(r)}
+	if len(segments) == 1 {
+		Templates.ExecuteTemplate(w, "play.html", context)
+		return
+	}
+	if segments[1] != "results" {
+		http.NotFound(w, r)
+		return
+	}
+	resultsHandler(w, r, context)
+}
+
+// resultsHandler reviews a finished game, and takes the name of the player
+// who played it to put it on the leaderboard.
+func resultsHandler(w http.ResponseWriter, r *http.Request, context PlayContext) {
+	game := context.Game
+	if !game.Finished() {
+		http.Redirect(w, r, game.Url(), http.StatusSeeOther)
+		return
 	}
-	filters := models.QuestionFilters{
-		Count:      count,
-		Category:   categoryId,
-		Difficulty: difficulty,
+	var err error
+	context.Challenge, err = getChallenge(r, game)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
 	}
-	questions, err := models.GetQuestions(&filters)
+	context.Entry, err = models.GetLeaderboardEntry(game.Id)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	// Only the player who played the game may put it on the leaderboard, and
+	// players with an account always go under their username.
+	player := currentPlayer(r)
+	owned := player != nil && player.Id == game.PlayerId
+	if context.Entry == nil && owned {
+		options, _ := url.ParseQuery(game.Options)
+		filters := parseFilters(options)
+		entry, err := models.NewLeaderboardEntry(game, &filters)
+		if err == models.ErrNotFirstAttempt {
+			if r.Method == "POST" {
+				http.Redirect(w, r, game.ResultsUrl(), http.StatusSeeOther)
+				return
+			}
+			context.Replay = true
+			Templates.ExecuteTemplate(w, "results.html", context)
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		var account *models.Player
+		if !player.Anonymous() {
+			account = player
+		}
+		form := forms.NewLeaderboardForm(r, entry, account)
+		if r.Method == "POST" {
+			form.Process()
+			if len(form.Errors) == 0 {
+				http.Redirect(w, r, game.ResultsUrl(), http.StatusSeeOther)
+				return
+			}
+		}
+		context.LeaderboardForm = &form
+	} else if r.Method == "POST" {
+		http.Redirect(w, r, game.ResultsUrl(), http.StatusSeeOther)
+		return
 	}
-	Templates.ExecuteTemplate(w, "play.html", questions)
+	Templates.ExecuteTemplate(w, "results.html", context)
 }
 
-type QuestionContext struct {
+type PlayContext struct {
+	Game      *models.Game
+	CsrfToken string
+	CsrfField template.HTML
+	// The rest are only used on the results page.
+	Challenge       *ChallengeContext
+	Entry           *models.LeaderboardEntry
+	LeaderboardForm *forms.LeaderboardForm
+	// Replay is set when the player had already finished a game with the
+	// same questions, so this one can't go on the leaderboard.
+	Replay bool
+}
+
+// Result returns the graded answer to a question, or nil if it hasn't been
+// answered yet.
+func (c PlayContext) Result(q *models.Question) *QuestionContext {
+	a := c.Game.Answers[q.Id]
+	if a == nil {
+		return nil
+	}
+	return newQuestionContext(q, a)
+}
+
+// Question returns the context for showing an unanswered question.
+func (c PlayContext) Question(q *models.Question) GameQuestionContext {
+	return GameQuestionContext{Game: c.Game, Question: q, Timer: c.Game.Timers[q.Id]}
+}
+
+// Current returns the index of the question to show: the first unanswered
+// one, or the last question once the game is finished.
+func (c PlayContext) Current() int {
+	for i, id := range c.Game.Questions.Keys() {
+		if c.Game.Answers[id] == nil {
+			return i
+		}
+	}
+	return c.Game.NumQuestions() - 1
+}
+
+// GameQuestionContext is a question waiting to be answered in a game, with
+// its timer if the game is timed.
+type GameQuestionContext struct {
+	Game     *models.Game
 	Question *models.Question
-	Answer   int
+	Timer    *models.Timer
+}
+
+type QuestionContext struct {
+	Question   *models.Question
+	Answers    []int
+	Response   string
+	Credit     float64
+	Late       bool
+	Points     int
+	SpeedBonus int
+	Multiplier float64
+}
+
+func newQuestionContext(q *models.Question, a *models.GameAnswer) *QuestionContext {
+	return &QuestionContext{
+		Question:   q,
+		Answers:    a.AnswerIds,
+		Response:   a.Response,
+		Credit:     a.Credit,
+		Late:       a.Late,
+		Points:     a.Points,
+		SpeedBonus: a.SpeedBonus,
+		Multiplier: a.Multiplier,
+	}
+}
+
+func (c QuestionContext) Correct() bool {
+	return c.Credit == 1
+}
+
+// Selected reports whether the player chose the answer with the given id.
+func (c QuestionContext) Selected(id int) bool {
+	for _, a := range c.Answers {
+		if a == id {
+			return true
+		}
+	}
+	return false
 }
 
+// Percent returns the credit earned as a whole percentage.
+func (c QuestionContext) Percent() int {
+	return int(math.Round(c.Credit * 100))
+}
+
+// AnswerHandler records the answer to a question in a game, responding with
+// the graded question and the updated score.
 func AnswerHandler(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
-	questionParam := query["question"]
-	answerParam := query["answer"]
-	if len(questionParam) == 0 || len(answerParam) == 0 {
-		http.Error(w, "Must provide question and answer", http.StatusBadRequest)
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	questionId, err := strconv.Atoi(questionParam[0])
+	r.ParseForm()
+	questionId, err := strconv.Atoi(r.PostForm.Get("question"))
 	if err != nil {
 		http.Error(w, "Invalid Question", http.StatusBadRequest)
 		return
 	}
-	answerId, err := strconv.Atoi(answerParam[0])
+	game, err := models.GetGame(r.PostForm.Get("game"))
 	if err != nil {
-		http.Error(w, "Invalid Answer", http.StatusBadRequest)
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if game == nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	question := game.Questions.Get(questionId)
+	if question == nil {
+		http.Error(w, "Question not found", http.StatusNotFound)
+		return
+	}
+	answerIds := []int{}
+	var response string
+	if question.Type == models.FreeText {
+		response = strings.TrimSpace(r.PostForm.Get("response"))
+		if response == "" && !game.TimedOut(questionId) {
+			http.Error(w, "Must provide question and answer", http.StatusBadRequest)
+			return
+		}
+	} else {
+		answerParam := r.PostForm["answer"]
+		// Once time is up an empty answer is accepted, and scores nothing.
+		if len(answerParam) == 0 && question.Type != models.SelectAll && !game.TimedOut(questionId) {
+			http.Error(w, "Must provide question and answer", http.StatusBadRequest)
+			return
+		}
+		for _, a := range answerParam {
+			answerId, err := strconv.Atoi(a)
+			if err != nil {
+				http.Error(w, "Invalid Answer", http.StatusBadRequest)
+				return
+			}
+			answerIds = append(answerIds, answerId)
+		}
+	}
+	answer, err := game.Answer(questionId, answerIds, response)
+	if err == models.ErrAlreadyAnswered {
+		http.Error(w, "Question already answered", http.StatusConflict)
 		return
 	}
-	question, err := models.GetQuestion(questionId)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		return
 	}
-	if question == nil {
+	trigger, _ := json.Marshal(map[string]any{"answered": map[string]any{
+		"finished": game.Finished(),
+		"points":   answer.Points,
+		"total":    game.Points,
+	}})
+	w.Header().Set("HX-Trigger-After-Swap", string(trigger))
+	Templates.ExecuteTemplate(w, "_answer.html", newQuestionContext(question, answer))
+	Templates.ExecuteTemplate(w, "_score.html", game)
+}
+
+// StartHandler starts the timer for a question in a timed game, responding
+// with the question to answer.
+func StartHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	questionId, err := strconv.Atoi(r.PostForm.Get("question"))
+	if err != nil {
+		http.Error(w, "Invalid Question", http.StatusBadRequest)
+		return
+	}
+	game, err := models.GetGame(r.PostForm.Get("game"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if game == nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if game.Answers[questionId] != nil {
+		http.Error(w, "Question already answered", http.StatusConflict)
+		return
+	}
+	timer, err := game.Start(questionId)
+	if err == models.ErrNotInGame {
 		http.Error(w, "Question not found", http.StatusNotFound)
 		return
 	}
-	if question.Answer.Id == answerId {
-		w.Header().Set("HX-Trigger-After-Swap", "correct")
-	} else {
-		w.Header().Set("HX-Trigger-After-Swap", "incorrect")
+	if err == models.ErrNotTimed {
+		http.Error(w, "Game is not timed", http.StatusBadRequest)
+		return
 	}
-	Templates.ExecuteTemplate(w, "_answer.html", QuestionContext{Question: question, Answer: answerId})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	question := game.Questions.Get(questionId)
+	Templates.ExecuteTemplate(w, "_question.html", GameQuestionContext{Game: game, Question: question, Timer: timer})
 }
 
 func questionFormHandler(w http.ResponseWriter, r *http.Request) {
@@ -117,3 +459,41 @@ func questionFormHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 var QuestionFormHandler = loginRequired(questionFormHandler)
+
+func questionEditHandler(w http.ResponseWriter, r *http.Request, id int) {
+	question, err := models.GetQuestion(id)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if question == nil {
+		http.NotFound(w, r)
+		return
+	}
+	form := forms.NewQuestionForm(r, question)
+	if r.Method == "POST" {
+		form.Process()
+		if len(form.Errors) == 0 {
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
+		}
+	} else {
+		form.AddEmptyQuestions()
+	}
+	Templates.ExecuteTemplate(w, "question_form.html", form)
+}
+
+// choiceRowsHandler re-renders the question form's choice rows after adding or
+// removing one, so that row indexes stay in step with the "correct" boxes.
+func choiceRowsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	form := forms.NewQuestionForm(r, &models.Question{})
+	index, _ := strconv.Atoi(r.FormValue("index"))
+	form.EditChoices(r.FormValue("action"), index)
+	Templates.ExecuteTemplate(w, "_choices.html", form)
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 	"trivia/db"
 	"trivia/handlers"
+	"trivia/models"
+	"trivia/storage"
 
 	"github.com/gorilla/csrf"
 	"github.com/joho/godotenv"
@@ -28,11 +34,47 @@ func main() {
 	}
 	defer db.Pool.Close()
 
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "media"
+	}
+	storage.Default, err = storage.NewLocalStorage(mediaDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		log.Fatal("Unable to open media storage")
+	}
+
+	for _, d := range models.Difficulties {
+		seconds, err := strconv.Atoi(os.Getenv("TIME_LIMIT_" + strings.ToUpper(d)))
+		if err == nil && seconds > 0 {
+			models.TimeLimits[d] = time.Duration(seconds) * time.Second
+		}
+	}
+	// SCORING overrides some or all of the scoring rules as JSON, e.g.
+	// {"DifficultyPoints": {"hard": 500}, "SpeedBonus": 0}.
+	if scoring := os.Getenv("SCORING"); scoring != "" {
+		err = json.Unmarshal([]byte(scoring), &models.Scoring)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			log.Fatal("Invalid scoring rules")
+		}
+	}
+
 	r.HandleFunc("/", handlers.OptionsHandler)
 	r.HandleFunc("/play/", handlers.PlayHandler)
+	r.HandleFunc("/challenge/", handlers.ChallengeHandler)
+	r.HandleFunc("/leaderboard/", handlers.LeaderboardHandler)
+	r.HandleFunc("/signup/", handlers.SignupHandler)
+	r.HandleFunc("/login/", handlers.PlayerLogin)
+	r.HandleFunc("/logout/", handlers.PlayerLogout)
+	r.HandleFunc("/account/", handlers.AccountHandler)
+	r.HandleFunc("/api/start/", handlers.StartHandler)
 	r.HandleFunc("/api/answer/", handlers.AnswerHandler)
+	r.HandleFunc("/media/", handlers.MediaHandler)
 	r.HandleFunc("/admin/", handlers.AdminHandler)
+	r.HandleFunc("/admin/questions/", handlers.AdminQuestionsHandler)
 	r.HandleFunc("/admin/questions/add/", handlers.QuestionFormHandler)
+	r.HandleFunc("/admin/categories/", handlers.AdminCategoriesHandler)
 	r.HandleFunc("/admin/login/", handlers.Login)
 	r.HandleFunc("/admin/logout/", handlers.Logout)
 
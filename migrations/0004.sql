@@ -0,0 +1,2 @@
+ALTER TABLE "questions"
+ADD "archived" BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,11 @@
+CREATE TYPE question_type AS ENUM ('multiple', 'boolean');
+ALTER TABLE "questions"
+ADD "type" question_type NOT NULL DEFAULT 'multiple';
+UPDATE "questions"
+SET "type" = 'boolean'
+WHERE "id" IN (
+    SELECT "question_id"
+    FROM "answers"
+    GROUP BY "question_id"
+    HAVING COUNT(*) = 2 AND bool_and("text" IN ('True', 'False'))
+);
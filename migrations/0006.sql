@@ -0,0 +1 @@
+ALTER TYPE question_type ADD VALUE 'text';
@@ -0,0 +1,3 @@
+ALTER TYPE question_type ADD VALUE 'select';
+ALTER TABLE "questions"
+ADD "partial_credit" BOOLEAN NOT NULL DEFAULT FALSE;
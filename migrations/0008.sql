@@ -0,0 +1,3 @@
+ALTER TABLE "questions"
+ADD "explanation" TEXT NOT NULL DEFAULT '',
+ADD "source_url" VARCHAR(2048) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE "questions"
+ADD "image" VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE "answers"
+ADD "image" VARCHAR(255) NOT NULL DEFAULT '';
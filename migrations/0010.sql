@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS "tags" (
+    "id" SERIAL PRIMARY KEY,
+    "name" VARCHAR(255) UNIQUE NOT NULL
+);
+CREATE TABLE IF NOT EXISTS "tagging" (
+    "tag_id" INT,
+    "question_id" INT,
+    CONSTRAINT "fk_tag_id" FOREIGN KEY ("tag_id") REFERENCES "tags"("id"),
+    CONSTRAINT "fk_question_id" FOREIGN KEY ("question_id") REFERENCES "questions"("id"),
+    PRIMARY KEY("tag_id", "question_id")
+);
@@ -0,0 +1,23 @@
+UPDATE "categories"
+SET "name" = replace(replace(replace(replace(replace("name",
+    '&quot;', '"'), '&#039;', ''''), '&lt;', '<'), '&gt;', '>'), '&amp;', '&')
+WHERE "name" LIKE '%&%;%';
+ALTER TABLE "categories"
+ADD "parent_id" INT,
+ADD CONSTRAINT "fk_parent_id" FOREIGN KEY ("parent_id") REFERENCES "categories"("id");
+INSERT INTO "categories" ("name")
+SELECT DISTINCT split_part("name", ': ', 1)
+FROM "categories"
+WHERE "name" LIKE '%: %'
+ON CONFLICT ("name") DO NOTHING;
+ALTER TABLE "categories"
+DROP CONSTRAINT "categories_name_key";
+CREATE UNIQUE INDEX "categories_parent_name_key" ON "categories" (COALESCE("parent_id", 0), "name");
+UPDATE "categories" AS "child"
+SET
+    "parent_id" = "parent"."id",
+    "name" = substring("child"."name" FROM position(': ' IN "child"."name") + 2)
+FROM "categories" AS "parent"
+WHERE "child"."name" LIKE '%: %'
+    AND "parent"."name" = split_part("child"."name", ': ', 1)
+    AND "parent"."parent_id" IS NULL;
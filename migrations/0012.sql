@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS "games" (
+    "id" SERIAL PRIMARY KEY,
+    "token" VARCHAR(255) UNIQUE NOT NULL,
+    "options" TEXT NOT NULL DEFAULT '',
+    "score" DOUBLE PRECISION NOT NULL DEFAULT 0,
+    "created_at" TIMESTAMP NOT NULL,
+    "finished_at" TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS "game_questions" (
+    "game_id" INT NOT NULL,
+    "question_id" INT NOT NULL,
+    "position" INT NOT NULL,
+    CONSTRAINT "fk_game_id" FOREIGN KEY ("game_id") REFERENCES "games"("id"),
+    CONSTRAINT "fk_question_id" FOREIGN KEY ("question_id") REFERENCES "questions"("id"),
+    PRIMARY KEY ("game_id", "question_id")
+);
+CREATE TABLE IF NOT EXISTS "game_answers" (
+    "game_id" INT NOT NULL,
+    "question_id" INT NOT NULL,
+    "answer_ids" INT[] NOT NULL DEFAULT '{}',
+    "response" TEXT NOT NULL DEFAULT '',
+    "credit" DOUBLE PRECISION NOT NULL,
+    "answered_at" TIMESTAMP NOT NULL,
+    CONSTRAINT "fk_game_question" FOREIGN KEY ("game_id", "question_id") REFERENCES "game_questions"("game_id", "question_id"),
+    PRIMARY KEY ("game_id", "question_id")
+);
@@ -0,0 +1,8 @@
+ALTER TABLE "games"
+ADD "seed" VARCHAR(255);
+UPDATE "games"
+SET "seed" = substr(md5(random()::text), 1, 8);
+ALTER TABLE "games"
+ALTER COLUMN "seed"
+SET NOT NULL;
+CREATE INDEX "games_seed_idx" ON "games" ("seed");
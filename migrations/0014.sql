@@ -0,0 +1,7 @@
+ALTER TABLE "games"
+ADD "timed" BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE "game_questions"
+ADD "started_at" TIMESTAMP,
+ADD "deadline" TIMESTAMP;
+ALTER TABLE "game_answers"
+ADD "late" BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,6 @@
+ALTER TABLE "games"
+ADD "points" INT NOT NULL DEFAULT 0;
+ALTER TABLE "game_answers"
+ADD "points" INT NOT NULL DEFAULT 0,
+ADD "speed_bonus" INT NOT NULL DEFAULT 0,
+ADD "multiplier" DOUBLE PRECISION NOT NULL DEFAULT 1;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS "leaderboard" (
+    "id" SERIAL PRIMARY KEY,
+    "game_id" INT NOT NULL,
+    "name" VARCHAR(50) NOT NULL,
+    "points" INT NOT NULL,
+    "score" DOUBLE PRECISION NOT NULL,
+    "num_questions" INT NOT NULL,
+    "difficulty" VARCHAR(255) NOT NULL DEFAULT '',
+    "categories" INT[] NOT NULL DEFAULT '{}',
+    "created_at" TIMESTAMP NOT NULL,
+    CONSTRAINT "fk_game_id" FOREIGN KEY ("game_id") REFERENCES "games"("id"),
+    CONSTRAINT "leaderboard_game_id_key" UNIQUE ("game_id")
+);
+CREATE INDEX "leaderboard_points_idx" ON "leaderboard" ("points" DESC);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS "players" (
+    "id" SERIAL PRIMARY KEY,
+    "username" VARCHAR(50) NOT NULL,
+    "password" VARCHAR(255) NOT NULL,
+    "created_at" TIMESTAMP NOT NULL
+);
+CREATE UNIQUE INDEX "players_username_key" ON "players" (lower("username"));
+ALTER TABLE "sessions"
+ALTER COLUMN "user_id" DROP NOT NULL,
+ADD "player_id" INT,
+ADD CONSTRAINT "fk_player_id" FOREIGN KEY ("player_id") REFERENCES "players"("id"),
+ADD CONSTRAINT "sessions_owner_check" CHECK (("user_id" IS NULL) <> ("player_id" IS NULL));
+ALTER TABLE "games"
+ADD "player_id" INT,
+ADD CONSTRAINT "fk_player_id" FOREIGN KEY ("player_id") REFERENCES "players"("id");
+CREATE INDEX "games_player_id_idx" ON "games" ("player_id");
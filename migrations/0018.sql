@@ -0,0 +1,4 @@
+ALTER TABLE "players"
+ALTER COLUMN "username" DROP NOT NULL,
+ALTER COLUMN "password" DROP NOT NULL,
+ADD CONSTRAINT "players_anonymous_check" CHECK (("username" IS NULL) = ("password" IS NULL));
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS "seen_questions" (
+    "player_id" INT NOT NULL,
+    "question_id" INT NOT NULL,
+    "seen_at" TIMESTAMP NOT NULL,
+    CONSTRAINT "fk_player_id" FOREIGN KEY ("player_id") REFERENCES "players"("id"),
+    CONSTRAINT "fk_question_id" FOREIGN KEY ("question_id") REFERENCES "questions"("id"),
+    PRIMARY KEY ("player_id", "question_id")
+);
+ALTER TABLE "games"
+ADD "repeats" INT NOT NULL DEFAULT 0;
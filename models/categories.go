@@ -0,0 +1,284 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"trivia/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Categories form a two level hierarchy: a top level category such as
+// "Entertainment" may have subcategories such as "Video Games", but
+// subcategories may not have subcategories of their own.
+type Category struct {
+	Id            int
+	Name          string
+	ParentId      int
+	ParentName    string
+	Children      []*Category
+	QuestionCount int
+}
+
+// FullName returns the name prefixed with the parent's, in the
+// "Entertainment: Video Games" form used by OpenTDB.
+func (c *Category) FullName() string {
+	if c.ParentName == "" {
+		return c.Name
+	}
+	return c.ParentName + ": " + c.Name
+}
+
+// categoryColumns selects the columns scanned by scanCategory, and must be
+// used along with categoryParentJoin.
+const categoryColumns = "categories.id, categories.name, COALESCE(categories.parent_id, 0), COALESCE(parents.name, '')"
+
+const categoryParentJoin = "LEFT JOIN categories AS parents ON parents.id = categories.parent_id"
+
+// categoryOrder sorts subcategories directly after their parent.
+const categoryOrder = "COALESCE(parents.name, categories.name), categories.parent_id NULLS FIRST, categories.name"
+
+func scanCategory(row pgx.Row, c *Category, extra ...any) error {
+	return row.Scan(append([]any{&c.Id, &c.Name, &c.ParentId, &c.ParentName}, extra...)...)
+}
+
+// GetCategories returns every category, with subcategories directly after
+// their parent.
+func GetCategories() ([]*Category, error) {
+	categories := []*Category{}
+	rows, err := db.Pool.Query(
+		context.Background(),
+		"SELECT "+categoryColumns+" FROM categories "+categoryParentJoin+" ORDER BY "+categoryOrder,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		c := Category{}
+		err := scanCategory(rows, &c)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, &c)
+	}
+	return categories, nil
+}
+
+// GetCategoryTree returns the top level categories with their subcategories
+// filled in.
+func GetCategoryTree() ([]*Category, error) {
+	categories, err := GetCategories()
+	if err != nil {
+		return nil, err
+	}
+	return buildCategoryTree(categories), nil
+}
+
+func buildCategoryTree(categories []*Category) []*Category {
+	tree := []*Category{}
+	parents := map[int]*Category{}
+	for _, c := range categories {
+		if c.ParentId == 0 {
+			tree = append(tree, c)
+			parents[c.Id] = c
+		}
+	}
+	for _, c := range categories {
+		if p, ok := parents[c.ParentId]; ok {
+			p.Children = append(p.Children, c)
+		}
+	}
+	return tree
+}
+
+// GetCategoriesWithCounts is like GetCategories but also fills in the number
+// of questions filed under each category.
+func GetCategoriesWithCounts() ([]*Category, error) {
+	categories := []*Category{}
+	rows, err := db.Pool.Query(
+		context.Background(),
+		`
+			SELECT `+categoryColumns+`, COUNT(categorization.question_id)
+			FROM categories
+			`+categoryParentJoin+`
+			LEFT JOIN categorization ON categorization.category_id = categories.id
+			GROUP BY categories.id, parents.name
+			ORDER BY `+categoryOrder,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		c := Category{}
+		err := scanCategory(rows, &c, &c.QuestionCount)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, &c)
+	}
+	return categories, nil
+}
+
+func GetCategory(id int) (*Category, error) {
+	c := Category{}
+	err := scanCategory(db.Pool.QueryRow(
+		context.Background(),
+		"SELECT "+categoryColumns+" FROM categories "+categoryParentJoin+" WHERE categories.id = $1",
+		id,
+	), &c)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SplitCategoryName splits an OpenTDB category name such as
+// "Science: Computers" into its parent and subcategory names. Names without
+// a prefix have no parent.
+func SplitCategoryName(name string) (parent string, child string) {
+	parent, child, found := strings.Cut(name, ": ")
+	if !found {
+		return "", name
+	}
+	return strings.TrimSpace(parent), strings.TrimSpace(child)
+}
+
+// EnsureCategory returns the id of the category with the given OpenTDB name,
+// creating it and its parent if they don't exist yet.
+func EnsureCategory(conn *pgxpool.Pool, name string) (int, error) {
+	if conn == nil {
+		conn = db.Pool
+	}
+	parentName, childName := SplitCategoryName(name)
+	parentId := 0
+	if parentName != "" {
+		var err error
+		parentId, err = ensureCategory(conn, parentName, 0)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return ensureCategory(conn, childName, parentId)
+}
+
+func ensureCategory(conn *pgxpool.Pool, name string, parentId int) (int, error) {
+	var id int
+	err := conn.QueryRow(
+		context.Background(),
+		`
+			WITH inserted AS (
+				INSERT INTO categories (name, parent_id) VALUES ($1, NULLIF($2, 0))
+				ON CONFLICT DO NOTHING
+				RETURNING id
+			)
+			SELECT id FROM inserted
+			UNION ALL
+			SELECT id FROM categories WHERE name = $1 AND COALESCE(parent_id, 0) = $2
+			LIMIT 1
+		`,
+		name, parentId,
+	).Scan(&id)
+	return id, err
+}
+
+func (c *Category) Create() error {
+	err := db.Pool.QueryRow(
+		context.Background(),
+		"INSERT INTO categories (name, parent_id) VALUES ($1, NULLIF($2, 0)) RETURNING id",
+		c.Name, c.ParentId,
+	).Scan(&c.Id)
+	return categoryError(err)
+}
+
+func (c *Category) Update() error {
+	_, err := db.Pool.Exec(
+		context.Background(),
+		"UPDATE categories SET name = $1, parent_id = NULLIF($2, 0) WHERE id = $3",
+		c.Name, c.ParentId, c.Id,
+	)
+	return categoryError(err)
+}
+
+// HasChildren reports whether any categories are filed under c.
+func (c *Category) HasChildren() (bool, error) {
+	var exists bool
+	err := db.Pool.QueryRow(
+		context.Background(),
+		"SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id = $1)",
+		c.Id,
+	).Scan(&exists)
+	return exists, err
+}
+
+// Delete removes the category. Its questions are kept but are no longer
+// filed under it, and its subcategories become top level categories.
+func (c *Category) Delete() error {
+	return runInTx(nil, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "DELETE FROM categorization WHERE category_id = $1", c.Id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "UPDATE categories SET parent_id = NULL WHERE parent_id = $1", c.Id)
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.ConstraintName == "categories_parent_name_key" {
+			return errors.New("a subcategory has the same name as a top level category; rename or merge it first")
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM categories WHERE id = $1", c.Id)
+		return err
+	})
+}
+
+// MergeInto refiles every question in c under target, moves c's
+// subcategories under target and then deletes c.
+func (c *Category) MergeInto(target *Category) error {
+	if c.Id == target.Id {
+		return errors.New("cannot merge a category into itself")
+	}
+	if target.ParentId == c.Id {
+		return errors.New("cannot merge a category into one of its subcategories")
+	}
+	return runInTx(nil, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(
+			ctx,
+			`
+				INSERT INTO categorization (question_id, category_id)
+				SELECT question_id, $2 FROM categorization WHERE category_id = $1
+				ON CONFLICT DO NOTHING
+			`,
+			c.Id, target.Id,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM categorization WHERE category_id = $1", c.Id)
+		if err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, "UPDATE categories SET parent_id = $2 WHERE parent_id = $1", c.Id, target.Id)
+		if err != nil {
+			return categoryError(err)
+		}
+		if tag.RowsAffected() > 0 && target.ParentId != 0 {
+			return errors.New("cannot merge a category with subcategories into a subcategory")
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM categories WHERE id = $1", c.Id)
+		return err
+	})
+}
+
+func categoryError(err error) error {
+	if pgErr, ok := err.(*pgconn.PgError); ok {
+		if pgErr.ConstraintName == "categories_parent_name_key" {
+			return errors.New("this category already exists")
+		}
+	}
+	return err
+}
@@ -0,0 +1,584 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math"
+	"sort"
+	"time"
+	"trivia/db"
+	"trivia/utils"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotInGame       = errors.New("question is not part of this game")
+	ErrAlreadyAnswered = errors.New("question has already been answered")
+	ErrNotTimed        = errors.New("game is not timed")
+)
+
+// TimeLimits is how long players have to answer a question of each
+// difficulty in a timed game.
+var TimeLimits = map[string]time.Duration{
+	"easy":   15 * time.Second,
+	"medium": 20 * time.Second,
+	"hard":   30 * time.Second,
+}
+
+// deadlineGrace allows for the time an answer takes to reach the server.
+const deadlineGrace = 2 * time.Second
+
+// Game is one play through a set of questions. Answers are graded and the
+// score kept on the server, so a player can only answer each question once.
+// Token identifies the game in URLs and Options holds the query string it was
+// started with, so the same options can be played again. Games sharing a Seed
+// are a challenge: they have the same questions, and choices, in the same
+// order. In a timed game each question has to be answered within its
+// difficulty's time limit of being started. PlayerId is zero for games
+// played without an account. Repeats counts the questions the player had
+// already seen, which they get once there aren't enough new ones. It isn't
+// counted for challenges, whose questions are set by the original game.
+type Game struct {
+	Id         int
+	Token      string
+	PlayerId   int
+	Options    string
+	Seed       string
+	Timed      bool
+	Repeats    int
+	Questions  *utils.OrderedMap[int, *Question]
+	Answers    map[int]*GameAnswer
+	Timers     map[int]*Timer
+	Score      float64
+	Points     int
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+	challenge  bool
+}
+
+// GameAnswer is the player's response to one question of a game and the
+// credit and points it earned. Late answers, given after the deadline of a
+// timed question, earn none.
+type GameAnswer struct {
+	QuestionId int
+	AnswerIds  []int
+	Response   string
+	Credit     float64
+	Late       bool
+	Points     int
+	SpeedBonus int
+	Multiplier float64
+	AnsweredAt time.Time
+}
+
+// Timer records when a question of a timed game was started and the deadline
+// for answering it.
+type Timer struct {
+	StartedAt time.Time
+	Deadline  time.Time
+}
+
+// Remaining returns how long is left until the deadline, in milliseconds.
+func (t *Timer) Remaining() int64 {
+	remaining := time.Until(t.Deadline).Milliseconds()
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// seedChars leaves out characters that are easily confused when a challenge
+// code is read out or typed.
+const seedChars = "abcdefghjkmnpqrstuvwxyz23456789"
+
+func newSeed() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	for i := range b {
+		b[i] = seedChars[int(b[i])%len(seedChars)]
+	}
+	return string(b)
+}
+
+// NewGame starts a game for the player with questions matching the filters.
+// Unless the filters have a seed, the game is given a new one.
+func NewGame(filters *QuestionFilters, options string, timed bool, playerId int) (*Game, error) {
+	if filters.Seed == "" {
+		filters.Seed = newSeed()
+	}
+	filters.PlayerId = playerId
+	questions, err := GetQuestions(filters)
+	if err != nil {
+		return nil, err
+	}
+	g := Game{
+		Token:     uuid.New().String(),
+		PlayerId:  playerId,
+		Options:   options,
+		Seed:      filters.Seed,
+		Timed:     timed,
+		Questions: questions,
+		Answers:   map[int]*GameAnswer{},
+		Timers:    map[int]*Timer{},
+	}
+	err = g.Create(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// NewChallenge starts a game for the player with the same questions, in the
+// same order, as the first game played with the seed. It returns nil if there
+// is no such game.
+func NewChallenge(seed string, playerId int) (*Game, error) {
+	var token string
+	err := db.Pool.QueryRow(
+		context.Background(),
+		"SELECT token FROM games WHERE seed = $1 ORDER BY id LIMIT 1",
+		seed,
+	).Scan(&token)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	original, err := GetGame(token)
+	if err != nil || original == nil {
+		return nil, err
+	}
+	g := Game{
+		Token:     uuid.New().String(),
+		PlayerId:  playerId,
+		Options:   original.Options,
+		Seed:      seed,
+		Timed:     original.Timed,
+		Questions: original.Questions,
+		Answers:   map[int]*GameAnswer{},
+		Timers:    map[int]*Timer{},
+		challenge: true,
+	}
+	err = g.Create(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (g *Game) Create(conn *pgxpool.Pool) error {
+	g.CreatedAt = time.Now().UTC()
+	return runInTx(conn, func(ctx context.Context, tx pgx.Tx) error {
+		err := tx.QueryRow(
+			ctx,
+			`
+				INSERT INTO games (token, player_id, options, seed, timed, created_at)
+				VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6)
+				RETURNING id
+			`,
+			g.Token, g.PlayerId, g.Options, g.Seed, g.Timed, g.CreatedAt,
+		).Scan(&g.Id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			ctx,
+			`
+				INSERT INTO game_questions (game_id, question_id, position)
+				SELECT $1, q.id, q.position FROM unnest($2::int[]) WITH ORDINALITY AS q(id, position)
+			`,
+			g.Id, g.Questions.Keys(),
+		)
+		if err != nil || g.PlayerId == 0 {
+			return err
+		}
+		return g.markSeen(ctx, tx)
+	})
+}
+
+// markSeen records the game's questions as seen by its player, counting
+// those they had seen already unless the game is a challenge.
+func (g *Game) markSeen(ctx context.Context, tx pgx.Tx) error {
+	if !g.challenge {
+		err := tx.QueryRow(
+			ctx,
+			"SELECT COUNT(*) FROM seen_questions WHERE player_id = $1 AND question_id = ANY($2)",
+			g.PlayerId, g.Questions.Keys(),
+		).Scan(&g.Repeats)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "UPDATE games SET repeats = $2 WHERE id = $1", g.Id, g.Repeats)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(
+		ctx,
+		`
+			INSERT INTO seen_questions (player_id, question_id, seen_at)
+			SELECT $1, unnest($2::int[]), $3
+			ON CONFLICT (player_id, question_id) DO UPDATE SET seen_at = EXCLUDED.seen_at
+		`,
+		g.PlayerId, g.Questions.Keys(), g.CreatedAt,
+	)
+	return err
+}
+
+func (g *Game) Url() string {
+	return "/play/" + g.Token + "/"
+}
+
+// ReplayUrl starts a new game with the same options.
+func (g *Game) ReplayUrl() string {
+	return "/play/?" + g.Options
+}
+
+// RoundedScore returns the score to two decimal places, for display.
+func (g *Game) RoundedScore() float64 {
+	return math.Round(g.Score*100) / 100
+}
+
+func (g *Game) ResultsUrl() string {
+	return g.Url() + "results/"
+}
+
+func (g *Game) ChallengeUrl() string {
+	return "/challenge/" + g.Seed + "/"
+}
+
+// TimeTaken returns how long the player took to answer a question, counted
+// from when it was started in a timed game, or otherwise from the previous
+// answer or, for the first, from the start of the game.
+func (g *Game) TimeTaken(questionId int) time.Duration {
+	a := g.Answers[questionId]
+	if a == nil {
+		return 0
+	}
+	return g.timeTaken(a).Round(100 * time.Millisecond)
+}
+
+func (g *Game) timeTaken(a *GameAnswer) time.Duration {
+	if t := g.Timers[a.QuestionId]; t != nil {
+		return a.AnsweredAt.Sub(t.StartedAt)
+	}
+	start := g.CreatedAt
+	for _, other := range g.Answers {
+		if other.AnsweredAt.Before(a.AnsweredAt) && other.AnsweredAt.After(start) {
+			start = other.AnsweredAt
+		}
+	}
+	return a.AnsweredAt.Sub(start)
+}
+
+// Streak returns how many of the latest answers in a row were fully correct.
+func (g *Game) Streak() int {
+	answers := []*GameAnswer{}
+	for _, a := range g.Answers {
+		answers = append(answers, a)
+	}
+	sort.Slice(answers, func(i, j int) bool {
+		return answers[i].AnsweredAt.After(answers[j].AnsweredAt)
+	})
+	streak := 0
+	for _, a := range answers {
+		if a.Credit < 1 {
+			break
+		}
+		streak++
+	}
+	return streak
+}
+
+// Duration returns how long the game took to finish, or zero if it hasn't.
+func (g *Game) Duration() time.Duration {
+	if g.FinishedAt == nil {
+		return 0
+	}
+	return g.FinishedAt.Sub(g.CreatedAt).Round(time.Second)
+}
+
+func (g *Game) NumQuestions() int {
+	return len(g.Questions.Keys())
+}
+
+func (g *Game) NumAnswered() int {
+	return len(g.Answers)
+}
+
+func (g *Game) Finished() bool {
+	return g.FinishedAt != nil
+}
+
+// Start starts the timer for a question of a timed game, if it isn't already
+// running, and returns it.
+func (g *Game) Start(questionId int) (*Timer, error) {
+	q := g.Questions.Get(questionId)
+	if q == nil {
+		return nil, ErrNotInGame
+	}
+	if !g.Timed {
+		return nil, ErrNotTimed
+	}
+	now := time.Now().UTC()
+	t := Timer{}
+	// Only the first start sets the deadline, so reloading the page doesn't
+	// buy more time.
+	err := db.Pool.QueryRow(
+		context.Background(),
+		`
+			UPDATE game_questions SET
+				started_at = COALESCE(started_at, $3),
+				deadline = COALESCE(deadline, $4)
+			WHERE game_id = $1 AND question_id = $2
+			RETURNING started_at, deadline
+		`,
+		g.Id, questionId, now, now.Add(TimeLimits[q.Difficulty]),
+	).Scan(&t.StartedAt, &t.Deadline)
+	if err != nil {
+		return nil, err
+	}
+	g.Timers[questionId] = &t
+	return &t, nil
+}
+
+// Expired reports whether it is too late to answer a question of a timed
+// game, either because its deadline has passed or because it was never
+// started.
+func (g *Game) Expired(questionId int) bool {
+	if !g.Timed {
+		return false
+	}
+	t := g.Timers[questionId]
+	return t == nil || time.Now().After(t.Deadline.Add(deadlineGrace))
+}
+
+// TimedOut reports whether the deadline of a question of a timed game has
+// passed, ignoring the grace period. An empty answer after this point is the
+// page giving up when its countdown reaches zero.
+func (g *Game) TimedOut(questionId int) bool {
+	if !g.Timed {
+		return false
+	}
+	t := g.Timers[questionId]
+	return t == nil || time.Now().After(t.Deadline)
+}
+
+// Answer grades and records a response to one of the game's questions and
+// updates the score. The game is finished once every question is answered.
+func (g *Game) Answer(questionId int, answerIds []int, response string) (*GameAnswer, error) {
+	q := g.Questions.Get(questionId)
+	if q == nil {
+		return nil, ErrNotInGame
+	}
+	if g.Answers[questionId] != nil {
+		return nil, ErrAlreadyAnswered
+	}
+	empty := len(answerIds) == 0 && response == ""
+	a := GameAnswer{
+		QuestionId: questionId,
+		AnswerIds:  answerIds,
+		Response:   response,
+		Late:       g.Expired(questionId) || (empty && g.TimedOut(questionId)),
+		AnsweredAt: time.Now().UTC(),
+	}
+	if !a.Late {
+		a.Credit = q.Grade(answerIds, response)
+	}
+	err := runInTx(nil, func(ctx context.Context, tx pgx.Tx) error {
+		// Lock the game and reload its answers, so that concurrent answers
+		// see each other when working out the streak and the points.
+		_, err := tx.Exec(ctx, "SELECT 1 FROM games WHERE id = $1 FOR UPDATE", g.Id)
+		if err != nil {
+			return err
+		}
+		err = g.loadAnswers(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if g.Answers[questionId] != nil {
+			return ErrAlreadyAnswered
+		}
+		streak := g.Streak()
+		a.Multiplier = Scoring.Multiplier(streak)
+		a.SpeedBonus, a.Points = Scoring.Score(q.Difficulty, a.Credit, g.timeTaken(&a), streak)
+		tag, err := tx.Exec(
+			ctx,
+			`
+				INSERT INTO game_answers (
+					game_id, question_id, answer_ids, response, credit, late,
+					points, speed_bonus, multiplier, answered_at
+				)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+				ON CONFLICT DO NOTHING
+			`,
+			g.Id, a.QuestionId, a.AnswerIds, a.Response, a.Credit, a.Late,
+			a.Points, a.SpeedBonus, a.Multiplier, a.AnsweredAt,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrAlreadyAnswered
+		}
+		return tx.QueryRow(
+			ctx,
+			`
+				UPDATE games SET
+					score = (SELECT COALESCE(SUM(credit), 0) FROM game_answers WHERE game_id = $1),
+					points = (SELECT COALESCE(SUM(points), 0) FROM game_answers WHERE game_id = $1),
+					finished_at = CASE
+						WHEN (SELECT COUNT(*) FROM game_answers WHERE game_id = $1)
+							>= (SELECT COUNT(*) FROM game_questions WHERE game_id = $1)
+						THEN $2::timestamp
+					END
+				WHERE id = $1
+				RETURNING score, points, finished_at
+			`,
+			g.Id, a.AnsweredAt,
+		).Scan(&g.Score, &g.Points, &g.FinishedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	g.Answers[questionId] = &a
+	return &a, nil
+}
+
+// GetGame loads the game with the given token, along with its questions in
+// the order they are played, with their choices shuffled for the game, and
+// any answers so far.
+func GetGame(token string) (*Game, error) {
+	g := Game{
+		Questions: utils.NewOrderedMap[int, *Question](),
+		Answers:   map[int]*GameAnswer{},
+		Timers:    map[int]*Timer{},
+	}
+	err := db.Pool.QueryRow(
+		context.Background(),
+		`
+			SELECT
+				id, token, COALESCE(player_id, 0), options, seed, timed, repeats, score, points,
+				created_at, finished_at
+			FROM games WHERE token = $1
+		`,
+		token,
+	).Scan(
+		&g.Id, &g.Token, &g.PlayerId, &g.Options, &g.Seed, &g.Timed, &g.Repeats, &g.Score, &g.Points,
+		&g.CreatedAt, &g.FinishedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Pool.Query(
+		context.Background(),
+		`
+			SELECT
+				questions.id, questions.text, questions.type, questions.difficulty, questions.partial_credit,
+				questions.explanation, questions.source_url, questions.image,
+				game_questions.started_at, game_questions.deadline
+			FROM questions
+			JOIN game_questions ON game_questions.question_id = questions.id
+			WHERE game_questions.game_id = $1
+			ORDER BY game_questions.position
+		`,
+		g.Id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		q := Question{Choices: []*Answer{}}
+		var startedAt, deadline *time.Time
+		rows.Scan(
+			&q.Id, &q.Text, &q.Type, &q.Difficulty, &q.PartialCredit, &q.Explanation, &q.SourceUrl, &q.Image,
+			&startedAt, &deadline,
+		)
+		g.Questions.Insert(q.Id, &q)
+		if startedAt != nil && deadline != nil {
+			g.Timers[q.Id] = &Timer{StartedAt: *startedAt, Deadline: *deadline}
+		}
+	}
+	err = loadChoices(g.Questions)
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range g.Questions.Values() {
+		q.shuffleChoices(g.Seed)
+	}
+	err = g.loadAnswers(context.Background(), db.Pool)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// querier runs queries on either the pool or a transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// loadAnswers replaces the game's answers with those recorded so far.
+func (g *Game) loadAnswers(ctx context.Context, conn querier) error {
+	rows, err := conn.Query(
+		ctx,
+		`
+			SELECT question_id, answer_ids, response, credit, late, points, speed_bonus, multiplier, answered_at
+			FROM game_answers WHERE game_id = $1
+		`,
+		g.Id,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	g.Answers = map[int]*GameAnswer{}
+	for rows.Next() {
+		var a GameAnswer
+		rows.Scan(
+			&a.QuestionId, &a.AnswerIds, &a.Response, &a.Credit, &a.Late,
+			&a.Points, &a.SpeedBonus, &a.Multiplier, &a.AnsweredAt,
+		)
+		g.Answers[a.QuestionId] = &a
+	}
+	return rows.Err()
+}
+
+// GetChallengeGames returns the finished games played with the seed, most
+// points, then highest score and then fastest first. Only the games
+// themselves are loaded, not their questions or answers.
+func GetChallengeGames(seed string) ([]*Game, error) {
+	games := []*Game{}
+	rows, err := db.Pool.Query(
+		context.Background(),
+		`
+			SELECT id, token, COALESCE(player_id, 0), options, seed, timed, score, points, created_at, finished_at
+			FROM games
+			WHERE seed = $1 AND finished_at IS NOT NULL
+			ORDER BY points DESC, score DESC, finished_at - created_at, id
+		`,
+		seed,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		g := Game{
+			Questions: utils.NewOrderedMap[int, *Question](),
+			Answers:   map[int]*GameAnswer{},
+			Timers:    map[int]*Timer{},
+		}
+		rows.Scan(
+			&g.Id, &g.Token, &g.PlayerId, &g.Options, &g.Seed, &g.Timed, &g.Score, &g.Points, &g.CreatedAt, &g.FinishedAt,
+		)
+		games = append(games, &g)
+	}
+	return games, nil
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"trivia/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrGameNotFinished = errors.New("only finished games can go on the leaderboard")
+	ErrNotFirstAttempt = errors.New("only your first game with these questions can go on the leaderboard")
+)
+
+// LeaderboardEntry is a finished game submitted to the leaderboard under a
+// player's name. Difficulty and Categories record the options the game was
+// played with, for the per difficulty and per category boards: Difficulty is
+// empty for any difficulty or "mixed", and Categories empty for all of them.
+type LeaderboardEntry struct {
+	Id           int
+	GameId       int
+	Name         string
+	Points       int
+	Score        float64
+	NumQuestions int
+	Difficulty   string
+	Categories   []int
+	CreatedAt    time.Time
+}
+
+func (e *LeaderboardEntry) RoundedScore() float64 {
+	return math.Round(e.Score*100) / 100
+}
+
+// NewLeaderboardEntry prepares an entry for a finished game, without a name.
+// Only a player's first finished game with a seed may be entered, so that
+// replaying a challenge with the answers known can't farm the leaderboard.
+func NewLeaderboardEntry(g *Game, filters *QuestionFilters) (*LeaderboardEntry, error) {
+	if !g.Finished() {
+		return nil, ErrGameNotFinished
+	}
+	var replayed bool
+	err := db.Pool.QueryRow(
+		context.Background(),
+		`
+			SELECT EXISTS (
+				SELECT 1 FROM games
+				WHERE seed = $1 AND player_id = $2 AND (finished_at, id) < ($4, $3)
+			)
+		`,
+		g.Seed, g.PlayerId, g.Id, g.FinishedAt,
+	).Scan(&replayed)
+	if err != nil {
+		return nil, err
+	}
+	if replayed {
+		return nil, ErrNotFirstAttempt
+	}
+	e := LeaderboardEntry{
+		GameId:       g.Id,
+		Points:       g.Points,
+		Score:        g.Score,
+		NumQuestions: g.NumQuestions(),
+		Difficulty:   filters.Difficulty,
+		Categories:   filters.Categories,
+	}
+	if len(filters.Mix) > 0 {
+		e.Difficulty = "mixed"
+	}
+	return &e, nil
+}
+
+func (e *LeaderboardEntry) Create() error {
+	e.CreatedAt = time.Now().UTC()
+	err := db.Pool.QueryRow(
+		context.Background(),
+		`
+			INSERT INTO leaderboard (game_id, name, points, score, num_questions, difficulty, categories, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id
+		`,
+		e.GameId, e.Name, e.Points, e.Score, e.NumQuestions, e.Difficulty, e.Categories, e.CreatedAt,
+	).Scan(&e.Id)
+	return leaderboardError(err)
+}
+
+func leaderboardError(err error) error {
+	if pgErr, ok := err.(*pgconn.PgError); ok {
+		if pgErr.ConstraintName == "leaderboard_game_id_key" {
+			return errors.New("this game is already on the leaderboard")
+		}
+	}
+	return err
+}
+
+const leaderboardColumns = "id, game_id, name, points, score, num_questions, difficulty, categories, created_at"
+
+func scanLeaderboardEntry(row pgx.Row, e *LeaderboardEntry) error {
+	return row.Scan(
+		&e.Id, &e.GameId, &e.Name, &e.Points, &e.Score, &e.NumQuestions, &e.Difficulty, &e.Categories, &e.CreatedAt,
+	)
+}
+
+// GetLeaderboardEntry returns the entry for a game, or nil if it hasn't been
+// submitted.
+func GetLeaderboardEntry(gameId int) (*LeaderboardEntry, error) {
+	var e LeaderboardEntry
+	err := scanLeaderboardEntry(db.Pool.QueryRow(
+		context.Background(),
+		"SELECT "+leaderboardColumns+" FROM leaderboard WHERE game_id = $1",
+		gameId,
+	), &e)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// LeaderboardFilters pick one of the leaderboards. Weekly limits it to games
+// submitted since the start of the week. Category includes games played with
+// the category, or one of its subcategories, among those chosen.
+type LeaderboardFilters struct {
+	Weekly     bool
+	Category   int
+	Difficulty string
+	Limit      int
+}
+
+// GetLeaderboard returns the top entries, most points first.
+func GetLeaderboard(filters *LeaderboardFilters) ([]*LeaderboardEntry, error) {
+	entries := []*LeaderboardEntry{}
+	var query strings.Builder
+	params := []any{filters.Limit}
+	conditions := []string{"TRUE"}
+	query.WriteString("SELECT " + leaderboardColumns + " FROM leaderboard")
+	if filters.Weekly {
+		conditions = append(conditions, "created_at >= date_trunc('week', now() AT TIME ZONE 'utc')")
+	}
+	if filters.Category != 0 {
+		params = append(params, filters.Category)
+		conditions = append(conditions, fmt.Sprintf(
+			`EXISTS (
+				SELECT 1 FROM categories
+				WHERE categories.id = ANY(leaderboard.categories)
+					AND (categories.id = $%[1]v OR categories.parent_id = $%[1]v)
+			)`,
+			len(params),
+		))
+	}
+	if filters.Difficulty != "" {
+		params = append(params, filters.Difficulty)
+		conditions = append(conditions, fmt.Sprintf("difficulty = $%v", len(params)))
+	}
+	query.WriteString(" WHERE " + strings.Join(conditions, " AND "))
+	query.WriteString(" ORDER BY points DESC, score DESC, created_at LIMIT $1")
+	rows, err := db.Pool.Query(context.Background(), query.String(), params...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var e LeaderboardEntry
+		err = scanLeaderboardEntry(rows, &e)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+	return entries, nil
+}
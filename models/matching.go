@@ -0,0 +1,70 @@
+package models
+
+import (
+	"strings"
+	"trivia/utils"
+	"unicode"
+)
+
+var articles = []string{"the", "a", "an"}
+
+// NormalizeAnswer lowercases s, strips punctuation, collapses whitespace and
+// drops a leading article, so that "The Beatles!" and "beatles" compare equal.
+func NormalizeAnswer(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else if unicode.IsSpace(r) || r == '-' || r == '/' {
+			b.WriteRune(' ')
+		}
+	}
+	words := strings.Fields(b.String())
+	if len(words) > 1 {
+		for _, a := range articles {
+			if words[0] == a {
+				words = words[1:]
+				break
+			}
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// typoTolerance is how many edits a response may be away from the accepted
+// answer and still count. Short answers and answers containing numbers, where
+// a single character changes the meaning (Iran and Iraq, 1066 and 1067), must
+// match exactly.
+func typoTolerance(answer string) int {
+	if strings.IndexFunc(answer, unicode.IsDigit) != -1 {
+		return 0
+	}
+	length := len([]rune(answer))
+	switch {
+	case length < 6:
+		return 0
+	case length <= 7:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// AnswerMatches reports whether response matches any of the accepted answers
+// once both are normalized, allowing for small typos in longer answers.
+func AnswerMatches(response string, accepted []string) bool {
+	r := NormalizeAnswer(response)
+	if r == "" {
+		return false
+	}
+	for _, a := range accepted {
+		n := NormalizeAnswer(a)
+		if n == "" {
+			continue
+		}
+		if r == n || utils.Levenshtein(r, n) <= typoTolerance(n) {
+			return true
+		}
+	}
+	return false
+}
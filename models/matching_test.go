@@ -0,0 +1,60 @@
+package models
+
+import "testing"
+
+func TestNormalizeAnswer(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"The Beatles!", "beatles"},
+		{"  beatles  ", "beatles"},
+		{"Jean-Paul Sartre", "jean paul sartre"},
+		{"AC/DC", "ac dc"},
+		{"The", "the"},
+		{"A Tale of Two Cities", "tale of two cities"},
+		{"Mount   Everest.", "mount everest"},
+		{"Pokémon", "pokémon"},
+		{"1,066", "1066"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeAnswer(tt.in); got != tt.want {
+			t.Errorf("NormalizeAnswer(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAnswerMatches(t *testing.T) {
+	tests := []struct {
+		response string
+		accepted []string
+		want     bool
+	}{
+		{"the beatles", []string{"The Beatles"}, true},
+		{"Beatles", []string{"The Beatles"}, true},
+		{"Beatls", []string{"The Beatles"}, true},
+		{"Shakespear", []string{"William Shakespeare", "Shakespeare"}, true},
+		{"Shakspere", []string{"Shakespeare"}, true},
+		{"Shkspre", []string{"Shakespeare"}, false},
+		{"Paris", []string{"Paris"}, true},
+		{"Pari", []string{"Paris"}, false},
+		{"Iraq", []string{"Iran"}, false},
+		{"Mali", []string{"Bali"}, false},
+		{"Perm", []string{"Peru"}, false},
+		{"Madrid", []string{"Madrid"}, true},
+		{"Madrd", []string{"Madrid"}, true},
+		{"Mardid", []string{"Madrid"}, false},
+		{"Londn", []string{"London"}, true},
+		{"1067", []string{"1066"}, false},
+		{"1066", []string{"1066"}, true},
+		{"", []string{"Paris"}, false},
+		{"!!", []string{"Paris"}, false},
+		{"Paris", []string{""}, false},
+		{"Paris", nil, false},
+	}
+	for _, tt := range tests {
+		if got := AnswerMatches(tt.response, tt.accepted); got != tt.want {
+			t.Errorf("AnswerMatches(%q, %q) = %v, want %v", tt.response, tt.accepted, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+	"trivia/db"
+	"trivia/utils"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Player is someone playing the game. With an account, their history is kept
+// across devices. Anonymous players have no username or password and are
+// only known by a cookie, until they sign up or log in and Adopt moves their
+// history to their account. Players have no admin privileges; those belong to
+// User.
+type Player struct {
+	Id        int
+	Username  string
+	Password  string
+	CreatedAt time.Time
+}
+
+// GetPlayer returns the player with the username, ignoring case, or nil if
+// there isn't one.
+func GetPlayer(username string) (*Player, error) {
+	p := Player{}
+	err := db.Pool.QueryRow(
+		context.Background(),
+		"SELECT id, username, password, created_at FROM players WHERE lower(username) = lower($1)",
+		username,
+	).Scan(&p.Id, &p.Username, &p.Password, &p.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Player) Anonymous() bool {
+	return p.Username == ""
+}
+
+// NewAnonymousPlayer saves a player without an account.
+func NewAnonymousPlayer() (*Player, error) {
+	p := Player{CreatedAt: time.Now().UTC()}
+	err := db.Pool.QueryRow(
+		context.Background(),
+		"INSERT INTO players (created_at) VALUES ($1) RETURNING id",
+		p.CreatedAt,
+	).Scan(&p.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Adopt moves an anonymous player's games and seen questions to p, and then
+// deletes the anonymous player.
+func (p *Player) Adopt(anonymous *Player) error {
+	if !anonymous.Anonymous() || anonymous.Id == p.Id {
+		return nil
+	}
+	return runInTx(nil, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE games SET player_id = $1 WHERE player_id = $2", p.Id, anonymous.Id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			ctx,
+			`
+				INSERT INTO seen_questions (player_id, question_id, seen_at)
+				SELECT $1, question_id, seen_at FROM seen_questions WHERE player_id = $2
+				ON CONFLICT (player_id, question_id) DO NOTHING
+			`,
+			p.Id, anonymous.Id,
+		)
+		if err != nil {
+			return err
+		}
+		for _, query := range []string{
+			"DELETE FROM seen_questions WHERE player_id = $1",
+			"DELETE FROM sessions WHERE player_id = $1",
+			"DELETE FROM players WHERE id = $1 AND username IS NULL",
+		} {
+			_, err = tx.Exec(ctx, query, anonymous.Id)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (p Player) CheckPassword(password string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(p.Password), []byte(password))
+	return err == nil
+}
+
+// Create saves a new player, hashing their password.
+func (p *Player) Create() error {
+	hash, err := HashPassword(p.Password)
+	if err != nil {
+		return err
+	}
+	p.Password = hash
+	p.CreatedAt = time.Now().UTC()
+	err = db.Pool.QueryRow(
+		context.Background(),
+		"INSERT INTO players (username, password, created_at) VALUES ($1, $2, $3) RETURNING id",
+		p.Username, p.Password, p.CreatedAt,
+	).Scan(&p.Id)
+	return playerError(err)
+}
+
+func playerError(err error) error {
+	if pgErr, ok := err.(*pgconn.PgError); ok {
+		if pgErr.ConstraintName == "players_username_key" {
+			return errors.New("this username is taken")
+		}
+	}
+	return err
+}
+
+// ResetSeen forgets which questions the player has seen, so that any of them
+// can come up again.
+func (p *Player) ResetSeen() error {
+	_, err := db.Pool.Exec(context.Background(), "DELETE FROM seen_questions WHERE player_id = $1", p.Id)
+	return err
+}
+
+// PlayerStats totals up a player's games.
+type PlayerStats struct {
+	Games      int
+	Finished   int
+	Points     int
+	BestPoints int
+	Score      float64
+	Answered   int
+	Seen       int
+}
+
+// Accuracy returns the share of answered questions the player got right, as
+// a whole percentage.
+func (s *PlayerStats) Accuracy() int {
+	if s.Answered == 0 {
+		return 0
+	}
+	return int(math.Round(s.Score / float64(s.Answered) * 100))
+}
+
+func (p *Player) Stats() (*PlayerStats, error) {
+	s := PlayerStats{}
+	err := db.Pool.QueryRow(
+		context.Background(),
+		`
+			SELECT
+				COUNT(*), COUNT(finished_at), COALESCE(SUM(points), 0), COALESCE(MAX(points), 0),
+				COALESCE(SUM(score), 0),
+				(
+					SELECT COUNT(*) FROM game_answers
+					JOIN games ON games.id = game_answers.game_id
+					WHERE games.player_id = $1
+				),
+				(SELECT COUNT(*) FROM seen_questions WHERE player_id = $1)
+			FROM games WHERE player_id = $1
+		`,
+		p.Id,
+	).Scan(&s.Games, &s.Finished, &s.Points, &s.BestPoints, &s.Score, &s.Answered, &s.Seen)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GameSummary is a game in a player's history. Its questions and answers
+// aren't loaded, only counted.
+type GameSummary struct {
+	Game         *Game
+	NumQuestions int
+	NumAnswered  int
+}
+
+// History returns the player's most recent games, newest first.
+func (p *Player) History(limit int) ([]*GameSummary, error) {
+	games := []*GameSummary{}
+	rows, err := db.Pool.Query(
+		context.Background(),
+		`
+			SELECT
+				id, token, options, seed, timed, score, points, created_at, finished_at,
+				(SELECT COUNT(*) FROM game_questions WHERE game_id = games.id),
+				(SELECT COUNT(*) FROM game_answers WHERE game_id = games.id)
+			FROM games
+			WHERE player_id = $1
+			ORDER BY created_at DESC
+			LIMIT $2
+		`,
+		p.Id, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		s := GameSummary{Game: &Game{
+			Questions: utils.NewOrderedMap[int, *Question](),
+			Answers:   map[int]*GameAnswer{},
+			Timers:    map[int]*Timer{},
+		}}
+		g := s.Game
+		rows.Scan(
+			&g.Id, &g.Token, &g.Options, &g.Seed, &g.Timed, &g.Score, &g.Points, &g.CreatedAt, &g.FinishedAt,
+			&s.NumQuestions, &s.NumAnswered,
+		)
+		g.PlayerId = p.Id
+		games = append(games, &s)
+	}
+	return games, nil
+}
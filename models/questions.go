@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"os"
+	"sort"
 	"strings"
 	"trivia/db"
+	"trivia/storage"
 	"trivia/utils"
 
+	"github.com/bgaudino/godino"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -18,75 +22,452 @@ type Answer struct {
 	Id        int
 	Text      string
 	IsCorrect bool
+	Image     string
 }
 
-type Category struct {
-	Id   int
-	Name string
+// ImageUrl returns where the answer's image is served, if it has one.
+func (a *Answer) ImageUrl() string {
+	return imageUrl(a.Image)
 }
 
-func GetCategories() ([]*Category, error) {
-	categories := []*Category{}
-	rows, err := db.Pool.Query(context.Background(), "SELECT id, name FROM categories ORDER BY name")
-	if err != nil {
-		return nil, err
-	}
-	for rows.Next() {
-		c := Category{}
-		err := rows.Scan(&c.Id, &c.Name)
-		if err != nil {
-			return nil, err
+// Difficulties lists the question difficulties from easiest to hardest.
+var Difficulties = []string{"easy", "medium", "hard"}
+
+func IsDifficulty(d string) bool {
+	for _, difficulty := range Difficulties {
+		if d == difficulty {
+			return true
 		}
-		categories = append(categories, &c)
 	}
-	return categories, nil
+	return false
 }
 
+// Question types, named after the "type" values used by OpenTDB.
+const (
+	MultipleChoice = "multiple"
+	TrueFalse      = "boolean"
+	FreeText       = "text"
+	SelectAll      = "select"
+)
+
 type Question struct {
 	Id         int
 	Text       string
+	Type       string
 	Choices    []*Answer
 	Answer     *Answer
 	Difficulty string
 	Categories []*Category
+	Tags       []*Tag
+	Archived   bool
+	// PartialCredit lets select all that apply questions award a share of
+	// the credit for partly correct selections.
+	PartialCredit bool
+	// Explanation and SourceUrl are shown to players once they have answered.
+	Explanation string
+	SourceUrl   string
+	// Image is the storage key of the picture shown with the question.
+	Image string
 }
 
-func (q *Question) Create(conn *pgxpool.Pool) error {
-	if conn == nil {
-		conn = db.Pool
+// ImageUrl returns where the question's image is served, if it has one.
+func (q *Question) ImageUrl() string {
+	return imageUrl(q.Image)
+}
+
+func imageUrl(key string) string {
+	if key == "" {
+		return ""
+	}
+	return "/media/" + key
+}
+
+// images returns the storage keys of the question's image and those of its
+// choices.
+func (q *Question) images() []string {
+	images := []string{}
+	if q.Image != "" {
+		images = append(images, q.Image)
+	}
+	for _, c := range q.Choices {
+		if c.Image != "" {
+			images = append(images, c.Image)
+		}
 	}
-	ctx := context.Background()
-	tx, err := conn.BeginTx(ctx, pgx.TxOptions{})
+	return images
+}
+
+// storedImages returns the storage keys of every image currently saved for
+// the question and its choices.
+func storedImages(ctx context.Context, tx pgx.Tx, questionId int) ([]string, error) {
+	images := []string{}
+	rows, err := tx.Query(
+		ctx,
+		`
+			SELECT image FROM questions WHERE id = $1 AND image <> ''
+			UNION ALL
+			SELECT image FROM answers WHERE question_id = $1 AND image <> ''
+		`,
+		questionId,
+	)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	for rows.Next() {
+		var image string
+		err = rows.Scan(&image)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
 	}
+	return images, rows.Err()
+}
 
-	defer func() {
+// deleteImages removes the given images from storage, skipping any in keep.
+// Failures are logged rather than returned since the database changes that
+// orphaned the images have already been committed.
+func deleteImages(images []string, keep []string) {
+	kept := godino.NewSet(keep...)
+	for _, image := range images {
+		if kept.Has(image) {
+			continue
+		}
+		err := storage.Default.Delete(image)
 		if err != nil {
-			rbErr := tx.Rollback(ctx)
-			if rbErr != nil {
-				fmt.Fprintln(os.Stderr, rbErr.Error())
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
+}
+
+// TrueFalseChoices returns the choices for a true/false question whose
+// answer is answer, always with "True" first.
+func TrueFalseChoices(answer bool) []*Answer {
+	return []*Answer{
+		{Text: "True", IsCorrect: answer},
+		{Text: "False", IsCorrect: !answer},
+	}
+}
+
+// AcceptedAnswers returns the text of every correct choice. For free text
+// questions these are the responses that count as correct.
+func (q *Question) AcceptedAnswers() []string {
+	accepted := []string{}
+	for _, c := range q.Choices {
+		if c.IsCorrect {
+			accepted = append(accepted, c.Text)
+		}
+	}
+	return accepted
+}
+
+// Accepts reports whether a typed response to a free text question is
+// correct.
+func (q *Question) Accepts(response string) bool {
+	return AnswerMatches(response, q.AcceptedAnswers())
+}
+
+// Grade returns the credit, from 0 to 1, earned by a response to the question:
+// the ids of the chosen answers, or for free text questions the typed text.
+func (q *Question) Grade(answerIds []int, response string) float64 {
+	switch q.Type {
+	case FreeText:
+		if q.Accepts(response) {
+			return 1
+		}
+	case SelectAll:
+		return q.gradeSelection(answerIds)
+	default:
+		if len(answerIds) == 1 && q.Answer != nil && answerIds[0] == q.Answer.Id {
+			return 1
+		}
+	}
+	return 0
+}
+
+// gradeSelection scores a select all that apply response. Without partial
+// credit only the exact set of correct choices counts. With it, each correct
+// choice picked earns a share of the credit and each incorrect one picked
+// takes a share away.
+func (q *Question) gradeSelection(answerIds []int) float64 {
+	selected := godino.NewSet(answerIds...)
+	correct, hits, misses := 0, 0, 0
+	for _, c := range q.Choices {
+		if c.IsCorrect {
+			correct++
+			if selected.Has(c.Id) {
+				hits++
 			}
+		} else if selected.Has(c.Id) {
+			misses++
+		}
+	}
+	if correct == 0 {
+		return 0
+	}
+	if !q.PartialCredit {
+		if hits == correct && misses == 0 {
+			return 1
+		}
+		return 0
+	}
+	credit := float64(hits-misses) / float64(correct)
+	if credit < 0 {
+		return 0
+	}
+	return credit
+}
+
+// orderChoices puts "True" ahead of "False" for true/false questions, which
+// may have been stored in either order.
+func (q *Question) orderChoices() {
+	if q.Type == TrueFalse && len(q.Choices) == 2 && q.Choices[1].Text == "True" {
+		q.Choices[0], q.Choices[1] = q.Choices[1], q.Choices[0]
+	}
+}
+
+// shuffleChoices puts the choices in an order that depends on seed, so the
+// position of the correct answer can't be memorized, while the same seed
+// always gives the same order. True/false questions keep True first.
+func (q *Question) shuffleChoices(seed string) {
+	if q.Type == TrueFalse {
+		return
+	}
+	keys := map[int]uint64{}
+	for _, c := range q.Choices {
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%s:%d", seed, c.Id)
+		keys[c.Id] = h.Sum64()
+	}
+	sort.SliceStable(q.Choices, func(i, j int) bool {
+		return keys[q.Choices[i].Id] < keys[q.Choices[j].Id]
+	})
+}
+
+// HasCategory reports whether the question is filed under the category with
+// the given id.
+func (q *Question) HasCategory(id int) bool {
+	for _, c := range q.Categories {
+		if c.Id == id {
+			return true
 		}
-	}()
+	}
+	return false
+}
 
+func (q *Question) Create(conn *pgxpool.Pool) error {
 	if q.Difficulty == "" {
 		q.Difficulty = "medium"
 	}
-	err = tx.QueryRow(
-		ctx,
-		"INSERT INTO questions (text, difficulty) VALUES ($1, $2) RETURNING id",
-		q.Text, q.Difficulty,
-	).Scan(&q.Id)
-	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok {
-			if pgErr.ConstraintName == "questions_text_key" {
-				return errors.New("this question already exists")
+	if q.Type == "" {
+		q.Type = MultipleChoice
+	}
+	return runInTx(conn, func(ctx context.Context, tx pgx.Tx) error {
+		err := tx.QueryRow(
+			ctx,
+			`
+				INSERT INTO questions (text, type, difficulty, partial_credit, explanation, source_url, image)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				RETURNING id
+			`,
+			q.Text, q.Type, q.Difficulty, q.PartialCredit, q.Explanation, q.SourceUrl, q.Image,
+		).Scan(&q.Id)
+		if err != nil {
+			return questionError(err)
+		}
+		err = q.insertCategorizations(ctx, tx)
+		if err != nil {
+			return err
+		}
+		err = q.saveTags(ctx, tx)
+		if err != nil {
+			return err
+		}
+		return q.insertChoices(ctx, tx, q.Choices)
+	})
+}
+
+// Update rewrites the question's text, type, difficulty, categories and
+// choices. Choices with an id belonging to this question are updated in
+// place, choices without one are inserted and any existing choices left out
+// are removed. Images no longer used by the question are deleted from storage.
+func (q *Question) Update(conn *pgxpool.Pool) error {
+	if q.Type == "" {
+		q.Type = MultipleChoice
+	}
+	var oldImages []string
+	err := runInTx(conn, func(ctx context.Context, tx pgx.Tx) error {
+		var err error
+		oldImages, err = storedImages(ctx, tx, q.Id)
+		if err != nil {
+			return err
+		}
+		tag, err := tx.Exec(
+			ctx,
+			`
+				UPDATE questions
+				SET text = $1, type = $2, difficulty = $3, partial_credit = $4, explanation = $5, source_url = $6, image = $7
+				WHERE id = $8
+			`,
+			q.Text, q.Type, q.Difficulty, q.PartialCredit, q.Explanation, q.SourceUrl, q.Image, q.Id,
+		)
+		if err != nil {
+			return questionError(err)
+		}
+		if tag.RowsAffected() == 0 {
+			return errors.New("this question no longer exists")
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM categorization WHERE question_id = $1", q.Id)
+		if err != nil {
+			return err
+		}
+		err = q.insertCategorizations(ctx, tx)
+		if err != nil {
+			return err
+		}
+		err = q.saveTags(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		existing := godino.NewSet[int]()
+		rows, err := tx.Query(ctx, "SELECT id FROM answers WHERE question_id = $1", q.Id)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int
+			err = rows.Scan(&id)
+			if err != nil {
+				return err
 			}
+			existing.Add(id)
 		}
+		kept := []int{}
+		newChoices := []*Answer{}
+		for _, c := range q.Choices {
+			if existing.Has(c.Id) {
+				kept = append(kept, c.Id)
+			} else {
+				c.Id = 0
+				newChoices = append(newChoices, c)
+			}
+		}
+		_, err = tx.Exec(
+			ctx,
+			"DELETE FROM answers WHERE question_id = $1 AND NOT id = ANY($2)",
+			q.Id, kept,
+		)
+		if err != nil {
+			return err
+		}
+		// Move the kept choices out of the way first, so that texts can be
+		// swapped between them without tripping the uniqueness constraint.
+		_, err = tx.Exec(
+			ctx,
+			"UPDATE answers SET text = chr(1) || id WHERE id = ANY($1)",
+			kept,
+		)
+		if err != nil {
+			return err
+		}
+		for _, c := range q.Choices {
+			if c.Id == 0 {
+				continue
+			}
+			_, err = tx.Exec(
+				ctx,
+				"UPDATE answers SET text = $1, is_correct = $2, image = $3 WHERE id = $4",
+				c.Text, c.IsCorrect, c.Image, c.Id,
+			)
+			if err != nil {
+				return choiceError(err)
+			}
+		}
+		return q.insertChoices(ctx, tx, newChoices)
+	})
+	if err == nil {
+		deleteImages(oldImages, q.images())
+	}
+	return err
+}
+
+var ErrNotArchived = errors.New("only archived questions can be purged")
+
+// Archive moves the question to the trash, hiding it from games.
+func (q *Question) Archive() error {
+	return q.setArchived(true)
+}
+
+// Restore brings an archived question back out of the trash.
+func (q *Question) Restore() error {
+	return q.setArchived(false)
+}
+
+// setArchived moves the question in or out of the trash, returning
+// pgx.ErrNoRows if there is no such question.
+func (q *Question) setArchived(archived bool) error {
+	tag, err := db.Pool.Exec(
+		context.Background(),
+		"UPDATE questions SET archived = $1 WHERE id = $2",
+		archived, q.Id,
+	)
+	if err != nil {
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	q.Archived = archived
+	return nil
+}
 
+// Purge permanently deletes an archived question along with its answers,
+// categorizations, images and its place in past games (whose recorded scores
+// are kept). Questions that have not been archived are left alone with
+// ErrNotArchived, and pgx.ErrNoRows is returned if there is no such question.
+func (q *Question) Purge() error {
+	var images []string
+	err := runInTx(nil, func(ctx context.Context, tx pgx.Tx) error {
+		var archived bool
+		err := tx.QueryRow(ctx, "SELECT archived FROM questions WHERE id = $1 FOR UPDATE", q.Id).Scan(&archived)
+		if err != nil {
+			return err
+		}
+		if !archived {
+			return ErrNotArchived
+		}
+		images, err = storedImages(ctx, tx, q.Id)
+		if err != nil {
+			return err
+		}
+		for _, query := range []string{
+			"DELETE FROM categorization WHERE question_id = $1",
+			"DELETE FROM tagging WHERE question_id = $1",
+			"DELETE FROM game_answers WHERE question_id = $1",
+			"DELETE FROM game_questions WHERE question_id = $1",
+			"DELETE FROM seen_questions WHERE question_id = $1",
+			"DELETE FROM answers WHERE question_id = $1",
+			"DELETE FROM questions WHERE id = $1",
+		} {
+			_, err = tx.Exec(ctx, query, q.Id)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		deleteImages(images, nil)
+	}
+	return err
+}
+
+func (q *Question) insertCategorizations(ctx context.Context, tx pgx.Tx) error {
+	if len(q.Categories) == 0 {
+		return nil
+	}
 	var categorizationQuery strings.Builder
 	categorizationQuery.WriteString("INSERT INTO categorization (question_id, category_id) VALUES ")
 	categorizationParams := []any{}
@@ -99,26 +480,29 @@ func (q *Question) Create(conn *pgxpool.Pool) error {
 		}
 		paramNum += 2
 	}
-	_, err = tx.Exec(
+	_, err := tx.Exec(
 		ctx,
 		categorizationQuery.String(),
 		categorizationParams...,
 	)
-	if err != nil {
-		return err
-	}
+	return err
+}
 
+func (q *Question) insertChoices(ctx context.Context, tx pgx.Tx, choices []*Answer) error {
+	if len(choices) == 0 {
+		return nil
+	}
 	var answerQuery strings.Builder
-	answerQuery.WriteString("INSERT INTO answers (text, question_id, is_correct) VALUES ")
+	answerQuery.WriteString("INSERT INTO answers (text, question_id, is_correct, image) VALUES ")
 	answerParams := []any{}
-	paramNum = 1
-	for i, c := range q.Choices {
-		answerQuery.WriteString(fmt.Sprintf("($%v, $%v, $%v)", paramNum, paramNum+1, paramNum+2))
-		if i < len(q.Choices)-1 {
+	paramNum := 1
+	for i, c := range choices {
+		answerQuery.WriteString(fmt.Sprintf("($%v, $%v, $%v, $%v)", paramNum, paramNum+1, paramNum+2, paramNum+3))
+		if i < len(choices)-1 {
 			answerQuery.WriteByte(',')
 		}
-		answerParams = append(answerParams, []any{c.Text, q.Id, c.IsCorrect}...)
-		paramNum += 3
+		answerParams = append(answerParams, []any{c.Text, q.Id, c.IsCorrect, c.Image}...)
+		paramNum += 4
 	}
 	answerQuery.WriteString(" RETURNING id")
 	rows, err := tx.Query(
@@ -127,50 +511,128 @@ func (q *Question) Create(conn *pgxpool.Pool) error {
 		answerParams...,
 	)
 	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok {
-			if pgErr.ConstraintName == "answers_text_question_id_key" {
-				return errors.New("choices must be unique per question")
-			}
-		}
-		return err
+		return choiceError(err)
 	}
 	i := 0
 	for rows.Next() {
-		rows.Scan(&q.Choices[i].Id)
+		rows.Scan(&choices[i].Id)
 		i++
 	}
-	return tx.Commit(ctx)
+	return choiceError(rows.Err())
+}
+
+func questionError(err error) error {
+	if pgErr, ok := err.(*pgconn.PgError); ok {
+		if pgErr.ConstraintName == "questions_text_key" {
+			return errors.New("this question already exists")
+		}
+	}
+	return err
+}
+
+func choiceError(err error) error {
+	if pgErr, ok := err.(*pgconn.PgError); ok {
+		if pgErr.ConstraintName == "answers_text_question_id_key" {
+			return errors.New("choices must be unique per question")
+		}
+	}
+	return err
 }
 
 type QuestionFilters struct {
-	Category   int
-	Difficulty string
-	Count      int
+	// Categories limits the questions to those in any of the categories,
+	// while ExcludeCategories leaves out those in any of them. Both include
+	// subcategories.
+	Categories        []int
+	ExcludeCategories []int
+	Difficulty        string
+	// Tags limits the questions to those with at least one of the tags.
+	Tags  []string
+	Count int
+	// Mix asks for the given number of questions of each difficulty in place
+	// of Count questions of Difficulty.
+	Mix map[string]int
+	// Seed, when set, picks questions in an order that is repeatable for the
+	// same seed rather than at random.
+	Seed string
+	// PlayerId, when set, picks questions the player hasn't seen before any
+	// they have, which are only used once the others run out.
+	PlayerId int
+}
+
+// mixedQuestions fills each difficulty bucket of filters.Mix in turn, so the
+// questions run from easiest to hardest.
+func mixedQuestions(filters *QuestionFilters) (*utils.OrderedMap[int, *Question], error) {
+	questions := utils.NewOrderedMap[int, *Question]()
+	for _, d := range Difficulties {
+		if filters.Mix[d] <= 0 {
+			continue
+		}
+		bucket := *filters
+		bucket.Mix = nil
+		bucket.Difficulty = d
+		bucket.Count = filters.Mix[d]
+		qs, err := GetQuestions(&bucket)
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range qs.Values() {
+			questions.Insert(q.Id, q)
+		}
+	}
+	return questions, nil
 }
 
 func GetQuestions(filters *QuestionFilters) (*utils.OrderedMap[int, *Question], error) {
+	if len(filters.Mix) > 0 {
+		return mixedQuestions(filters)
+	}
 	questions := utils.NewOrderedMap[int, *Question]()
 	var query strings.Builder
 	params := []any{filters.Count}
-	query.WriteString("SELECT questions.id, questions.text, questions.difficulty FROM questions")
-	if filters.Category != 0 {
-		params = append(params, filters.Category)
-		query.WriteString(`
-			JOIN categorization ON questions.id = categorization.question_id
-			WHERE categorization.category_id = $2
-		`)
+	conditions := []string{"NOT questions.archived"}
+	query.WriteString("SELECT questions.id, questions.text, questions.type, questions.difficulty, questions.image FROM questions")
+	if len(filters.Categories) > 0 {
+		params = append(params, filters.Categories)
+		conditions = append(conditions, inCategories(len(params)))
+	}
+	if len(filters.ExcludeCategories) > 0 {
+		params = append(params, filters.ExcludeCategories)
+		conditions = append(conditions, "NOT "+inCategories(len(params)))
 	}
 	if filters.Difficulty != "" {
 		params = append(params, filters.Difficulty)
-		l := len(params)
-		if l > 2 {
-			query.WriteString(" AND ")
-		} else {
-			query.WriteString(" WHERE ")
-		}
-		query.WriteString(fmt.Sprintf("difficulty = $%v", l))
+		conditions = append(conditions, fmt.Sprintf("difficulty = $%v", len(params)))
+	}
+	if len(filters.Tags) > 0 {
+		params = append(params, filters.Tags)
+		conditions = append(conditions, fmt.Sprintf(
+			`EXISTS (
+				SELECT 1 FROM tagging JOIN tags ON tags.id = tagging.tag_id
+				WHERE tagging.question_id = questions.id AND tags.name = ANY($%v)
+			)`,
+			len(params),
+		))
+	}
+	query.WriteString(" WHERE " + strings.Join(conditions, " AND "))
+	order := []string{}
+	if filters.PlayerId != 0 {
+		params = append(params, filters.PlayerId)
+		order = append(order, fmt.Sprintf(
+			`EXISTS (
+				SELECT 1 FROM seen_questions
+				WHERE seen_questions.question_id = questions.id AND seen_questions.player_id = $%v
+			)`,
+			len(params),
+		))
 	}
-	query.WriteString(" ORDER BY RANDOM() LIMIT $1")
+	if filters.Seed != "" {
+		params = append(params, filters.Seed)
+		order = append(order, fmt.Sprintf("md5(questions.id::text || $%v)", len(params)))
+	} else {
+		order = append(order, "RANDOM()")
+	}
+	query.WriteString(" ORDER BY " + strings.Join(order, ", ") + " LIMIT $1")
 	rows, err := db.Pool.Query(
 		context.Background(),
 		query.String(),
@@ -181,25 +643,194 @@ func GetQuestions(filters *QuestionFilters) (*utils.OrderedMap[int, *Question],
 	}
 	for rows.Next() {
 		var q = Question{Choices: []*Answer{}}
-		rows.Scan(&q.Id, &q.Text, &q.Difficulty)
+		rows.Scan(&q.Id, &q.Text, &q.Type, &q.Difficulty, &q.Image)
 		questions.Insert(q.Id, &q)
 	}
-	rows, err = db.Pool.Query(
+	err = loadChoices(questions)
+	if err != nil {
+		return nil, err
+	}
+	return questions, nil
+}
+
+// loadChoices fills in the choices, and the first correct answer, of each of
+// the questions.
+func loadChoices(questions *utils.OrderedMap[int, *Question]) error {
+	rows, err := db.Pool.Query(
 		context.Background(),
-		"SELECT id, text, is_correct, question_id FROM answers WHERE question_id = ANY($1) ORDER BY id",
+		"SELECT id, text, is_correct, image, question_id FROM answers WHERE question_id = ANY($1) ORDER BY id",
 		questions.Keys(),
 	)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	for rows.Next() {
 		var id int
 		var answer Answer
-		rows.Scan(&answer.Id, &answer.Text, &answer.IsCorrect, &id)
+		rows.Scan(&answer.Id, &answer.Text, &answer.IsCorrect, &answer.Image, &id)
 		q := questions.Get(id)
 		q.Choices = append(q.Choices, &answer)
+		if answer.IsCorrect && q.Answer == nil {
+			q.Answer = &answer
+		}
 	}
-	return questions, nil
+	for _, q := range questions.Values() {
+		q.orderChoices()
+	}
+	return nil
+}
+
+// QuestionSearch describes a page of questions to list in the admin.
+// Sort is one of the keys of questionSortColumns, optionally prefixed with
+// "-" for descending order.
+type QuestionSearch struct {
+	Text       string
+	Category   int
+	Difficulty string
+	Archived   bool
+	Sort       string
+	Page       int
+	PageSize   int
+}
+
+var questionSortColumns = map[string]string{
+	"id":         "questions.id",
+	"text":       "questions.text",
+	"difficulty": "questions.difficulty",
+}
+
+type QuestionPage struct {
+	Questions []*Question
+	Total     int
+	Page      int
+	PageSize  int
+}
+
+func (p *QuestionPage) NumPages() int {
+	if p.Total == 0 {
+		return 1
+	}
+	return (p.Total + p.PageSize - 1) / p.PageSize
+}
+
+func (p *QuestionPage) HasPrev() bool {
+	return p.Page > 1
+}
+
+func (p *QuestionPage) HasNext() bool {
+	return p.Page < p.NumPages()
+}
+
+// SearchQuestions returns one page of questions matching s, along with the
+// total number of matches.
+func SearchQuestions(s *QuestionSearch) (*QuestionPage, error) {
+	if s.PageSize < 1 {
+		s.PageSize = 25
+	}
+	if s.Page < 1 {
+		s.Page = 1
+	}
+	params := []any{s.Archived}
+	conditions := []string{"questions.archived = $1"}
+	if s.Text != "" {
+		params = append(params, "%"+escapeLike(s.Text)+"%")
+		conditions = append(conditions, fmt.Sprintf("questions.text ILIKE $%v", len(params)))
+	}
+	if s.Category != 0 {
+		params = append(params, []int{s.Category})
+		conditions = append(conditions, inCategories(len(params)))
+	}
+	if s.Difficulty != "" {
+		params = append(params, s.Difficulty)
+		conditions = append(conditions, fmt.Sprintf("questions.difficulty = $%v", len(params)))
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	page := QuestionPage{Questions: []*Question{}, Page: s.Page, PageSize: s.PageSize}
+	err := db.Pool.QueryRow(
+		context.Background(),
+		"SELECT COUNT(*) FROM questions"+where,
+		params...,
+	).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	column, ok := questionSortColumns[strings.TrimPrefix(s.Sort, "-")]
+	if !ok {
+		s.Sort = "-id"
+		column = questionSortColumns["id"]
+	}
+	order := column
+	if strings.HasPrefix(s.Sort, "-") {
+		order += " DESC"
+	}
+	if column != questionSortColumns["id"] {
+		order += ", questions.id"
+	}
+	params = append(params, s.PageSize, (s.Page-1)*s.PageSize)
+	rows, err := db.Pool.Query(
+		context.Background(),
+		fmt.Sprintf(
+			"SELECT questions.id, questions.text, questions.type, questions.difficulty, questions.archived FROM questions%v ORDER BY %v LIMIT $%v OFFSET $%v",
+			where, order, len(params)-1, len(params),
+		),
+		params...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	questions := utils.NewOrderedMap[int, *Question]()
+	for rows.Next() {
+		q := Question{Categories: []*Category{}}
+		err := rows.Scan(&q.Id, &q.Text, &q.Type, &q.Difficulty, &q.Archived)
+		if err != nil {
+			return nil, err
+		}
+		questions.Insert(q.Id, &q)
+	}
+	rows, err = db.Pool.Query(
+		context.Background(),
+		`
+			SELECT `+categoryColumns+`, categorization.question_id
+			FROM categorization
+			JOIN categories ON categories.id = categorization.category_id
+			`+categoryParentJoin+`
+			WHERE categorization.question_id = ANY($1)
+			ORDER BY `+categoryOrder,
+		questions.Keys(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var c Category
+		scanCategory(rows, &c, &id)
+		q := questions.Get(id)
+		q.Categories = append(q.Categories, &c)
+	}
+	page.Questions = questions.Values()
+	return &page, nil
+}
+
+// inCategories returns a condition matching questions filed under any of the
+// categories whose ids are in the array query parameter n, or under any of
+// their subcategories.
+func inCategories(n int) string {
+	return fmt.Sprintf(
+		`EXISTS (
+			SELECT 1 FROM categorization
+			JOIN categories ON categories.id = categorization.category_id
+			WHERE categorization.question_id = questions.id
+				AND (categories.id = ANY($%v) OR categories.parent_id = ANY($%v))
+		)`,
+		n, n,
+	)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
 
 func GetQuestion(id int) (*Question, error) {
@@ -207,8 +838,11 @@ func GetQuestion(id int) (*Question, error) {
 	row, err := db.Pool.Query(
 		context.Background(),
 		`
-			SELECT questions.id, questions.text, answers.id, answers.text, answers.is_correct 
-			FROM questions 
+			SELECT
+				questions.id, questions.text, questions.type, questions.difficulty, questions.archived,
+				questions.partial_credit, questions.explanation, questions.source_url, questions.image,
+				answers.id, answers.text, answers.is_correct, answers.image
+			FROM questions
 			JOIN answers ON answers.question_id = questions.id
 			WHERE questions.id = $1
 			ORDER BY answers.id
@@ -219,14 +853,41 @@ func GetQuestion(id int) (*Question, error) {
 	}
 	for row.Next() {
 		var answer Answer
-		row.Scan(&question.Id, &question.Text, &answer.Id, &answer.Text, &answer.IsCorrect)
+		row.Scan(
+			&question.Id, &question.Text, &question.Type, &question.Difficulty, &question.Archived,
+			&question.PartialCredit, &question.Explanation, &question.SourceUrl, &question.Image,
+			&answer.Id, &answer.Text, &answer.IsCorrect, &answer.Image,
+		)
 		question.Choices = append(question.Choices, &answer)
-		if answer.IsCorrect {
+		if answer.IsCorrect && question.Answer == nil {
 			question.Answer = &answer
 		}
 	}
 	if len(question.Choices) == 0 {
 		return nil, nil
 	}
+	question.orderChoices()
+	row, err = db.Pool.Query(
+		context.Background(),
+		`
+			SELECT `+categoryColumns+`
+			FROM categories
+			JOIN categorization ON categorization.category_id = categories.id
+			`+categoryParentJoin+`
+			WHERE categorization.question_id = $1
+			ORDER BY `+categoryOrder, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for row.Next() {
+		var c Category
+		scanCategory(row, &c)
+		question.Categories = append(question.Categories, &c)
+	}
+	question.Tags, err = loadTags(id)
+	if err != nil {
+		return nil, err
+	}
 	return &question, nil
 }
@@ -0,0 +1,39 @@
+package models
+
+import "testing"
+
+func TestGradeSelection(t *testing.T) {
+	choices := []*Answer{
+		{Id: 1, IsCorrect: true},
+		{Id: 2, IsCorrect: true},
+		{Id: 3, IsCorrect: true},
+		{Id: 4},
+	}
+	tests := []struct {
+		partialCredit bool
+		choices       []*Answer
+		answerIds     []int
+		want          float64
+	}{
+		{false, choices, []int{1, 2, 3}, 1},
+		{false, choices, []int{3, 1, 2}, 1},
+		{false, choices, []int{1, 2}, 0},
+		{false, choices, []int{1, 2, 3, 4}, 0},
+		{false, choices, []int{}, 0},
+		{true, choices, []int{1, 2, 3}, 1},
+		{true, choices, []int{1, 2}, 2.0 / 3},
+		{true, choices, []int{1, 2, 4}, 1.0 / 3},
+		{true, choices, []int{1, 2, 3, 4}, 2.0 / 3},
+		{true, choices, []int{1, 4}, 0},
+		{true, choices, []int{4}, 0},
+		{true, choices, []int{}, 0},
+		{true, choices, []int{5}, 0},
+		{true, []*Answer{{Id: 1}, {Id: 2}}, []int{1}, 0},
+	}
+	for _, tt := range tests {
+		q := Question{Type: SelectAll, PartialCredit: tt.partialCredit, Choices: tt.choices}
+		if got := q.gradeSelection(tt.answerIds); got != tt.want {
+			t.Errorf("gradeSelection(%v) with partial credit %v = %v, want %v", tt.answerIds, tt.partialCredit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// ScoringRules decide how many points an answer is worth. A fully correct
+// answer earns the points for its difficulty, and partial credit a share of
+// them. Answering quickly earns up to SpeedBonus more, shrinking to nothing
+// after SpeedSeconds. Every StreakLength correct answers in a row add
+// StreakMultiplier to the multiplier applied to both, up to MaxMultiplier.
+type ScoringRules struct {
+	DifficultyPoints map[string]int
+	SpeedBonus       int
+	SpeedSeconds     int
+	StreakLength     int
+	StreakMultiplier float64
+	MaxMultiplier    float64
+}
+
+var Scoring = ScoringRules{
+	DifficultyPoints: map[string]int{"easy": 100, "medium": 200, "hard": 300},
+	SpeedBonus:       50,
+	SpeedSeconds:     20,
+	StreakLength:     3,
+	StreakMultiplier: 0.5,
+	MaxMultiplier:    3,
+}
+
+// Multiplier returns the multiplier earned by a streak of correct answers.
+func (r ScoringRules) Multiplier(streak int) float64 {
+	if r.StreakLength <= 0 {
+		return 1
+	}
+	return math.Min(1+float64(streak/r.StreakLength)*r.StreakMultiplier, math.Max(r.MaxMultiplier, 1))
+}
+
+// Score returns the speed bonus and total points for an answer earning credit
+// after taking the given time, following a streak of correct answers.
+func (r ScoringRules) Score(difficulty string, credit float64, taken time.Duration, streak int) (bonus int, points int) {
+	if credit <= 0 {
+		return 0, 0
+	}
+	if r.SpeedSeconds > 0 {
+		window := time.Duration(r.SpeedSeconds) * time.Second
+		speed := math.Max(0, 1-float64(taken)/float64(window))
+		bonus = int(math.Round(float64(r.SpeedBonus) * speed * credit))
+	}
+	base := float64(r.DifficultyPoints[difficulty]) * credit
+	points = int(math.Round((base + float64(bonus)) * r.Multiplier(streak)))
+	return bonus, points
+}
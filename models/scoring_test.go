@@ -0,0 +1,64 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMultiplier(t *testing.T) {
+	tests := []struct {
+		rules  ScoringRules
+		streak int
+		want   float64
+	}{
+		{Scoring, 0, 1},
+		{Scoring, 2, 1},
+		{Scoring, 3, 1.5},
+		{Scoring, 5, 1.5},
+		{Scoring, 6, 2},
+		{Scoring, 9, 2.5},
+		{Scoring, 12, 3},
+		{Scoring, 30, 3},
+		{ScoringRules{StreakLength: 0, StreakMultiplier: 0.5, MaxMultiplier: 3}, 10, 1},
+		{ScoringRules{StreakLength: 3, StreakMultiplier: 0.5, MaxMultiplier: 0.5}, 6, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.rules.Multiplier(tt.streak); got != tt.want {
+			t.Errorf("%+v.Multiplier(%v) = %v, want %v", tt.rules, tt.streak, got, tt.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	noSpeed := Scoring
+	noSpeed.SpeedSeconds = 0
+	tests := []struct {
+		rules      ScoringRules
+		difficulty string
+		credit     float64
+		taken      time.Duration
+		streak     int
+		wantBonus  int
+		wantPoints int
+	}{
+		{Scoring, "easy", 1, 0, 0, 50, 150},
+		{Scoring, "medium", 1, 10 * time.Second, 0, 25, 225},
+		{Scoring, "hard", 1, 30 * time.Second, 0, 0, 300},
+		{Scoring, "hard", 1, 20 * time.Second, 3, 0, 450},
+		{Scoring, "easy", 0.5, 0, 0, 25, 75},
+		{Scoring, "easy", 1, 5 * time.Second, 3, 38, 207},
+		{Scoring, "medium", 0, 0, 3, 0, 0},
+		{Scoring, "medium", -1, 0, 0, 0, 0},
+		{Scoring, "unknown", 1, 0, 0, 50, 50},
+		{noSpeed, "easy", 1, 0, 0, 0, 100},
+	}
+	for _, tt := range tests {
+		bonus, points := tt.rules.Score(tt.difficulty, tt.credit, tt.taken, tt.streak)
+		if bonus != tt.wantBonus || points != tt.wantPoints {
+			t.Errorf(
+				"Score(%q, %v, %v, %v) = %v, %v, want %v, %v",
+				tt.difficulty, tt.credit, tt.taken, tt.streak, bonus, points, tt.wantBonus, tt.wantPoints,
+			)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"trivia/db"
+
+	"github.com/bgaudino/godino"
+	"github.com/jackc/pgx/v5"
+)
+
+type Tag struct {
+	Id   int
+	Name string
+}
+
+// GetTags returns every tag in use on at least one question.
+func GetTags() ([]*Tag, error) {
+	tags := []*Tag{}
+	rows, err := db.Pool.Query(
+		context.Background(),
+		`
+			SELECT DISTINCT tags.id, tags.name
+			FROM tags
+			JOIN tagging ON tagging.tag_id = tags.id
+			ORDER BY tags.name
+		`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		t := Tag{}
+		err := rows.Scan(&t.Id, &t.Name)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, &t)
+	}
+	return tags, nil
+}
+
+// ParseTags splits a comma separated list of tags, lowercasing them and
+// dropping blanks and duplicates.
+func ParseTags(s string) []string {
+	seen := godino.NewSet[string]()
+	tags := []string{}
+	for _, t := range strings.Split(s, ",") {
+		t = strings.Join(strings.Fields(strings.ToLower(t)), " ")
+		if t == "" || seen.Has(t) {
+			continue
+		}
+		seen.Add(t)
+		tags = append(tags, t)
+	}
+	return tags
+}
+
+// TagNames returns the names of the question's tags.
+func (q *Question) TagNames() []string {
+	names := []string{}
+	for _, t := range q.Tags {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// saveTags replaces the question's tags, creating any that don't exist yet.
+func (q *Question) saveTags(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, "DELETE FROM tagging WHERE question_id = $1", q.Id)
+	if err != nil {
+		return err
+	}
+	names := q.TagNames()
+	if len(names) == 0 {
+		return nil
+	}
+	_, err = tx.Exec(
+		ctx,
+		"INSERT INTO tags (name) SELECT unnest($1::text[]) ON CONFLICT (name) DO NOTHING",
+		names,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		ctx,
+		"INSERT INTO tagging (tag_id, question_id) SELECT id, $2 FROM tags WHERE name = ANY($1)",
+		names, q.Id,
+	)
+	return err
+}
+
+func loadTags(questionId int) ([]*Tag, error) {
+	tags := []*Tag{}
+	rows, err := db.Pool.Query(
+		context.Background(),
+		`
+			SELECT tags.id, tags.name
+			FROM tags
+			JOIN tagging ON tagging.tag_id = tags.id
+			WHERE tagging.question_id = $1
+			ORDER BY tags.name
+		`,
+		questionId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		t := Tag{}
+		err := rows.Scan(&t.Id, &t.Name)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, &t)
+	}
+	return tags, nil
+}
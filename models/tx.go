@@ -0,0 +1,33 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"trivia/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// runInTx calls f inside a transaction on conn (or db.Pool when conn is nil),
+// committing if f succeeds and rolling back otherwise.
+func runInTx(conn *pgxpool.Pool, f func(ctx context.Context, tx pgx.Tx) error) error {
+	if conn == nil {
+		conn = db.Pool
+	}
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	err = f(ctx, tx)
+	if err != nil {
+		rbErr := tx.Rollback(ctx)
+		if rbErr != nil {
+			fmt.Fprintln(os.Stderr, rbErr.Error())
+		}
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -38,13 +38,25 @@ func HashPassword(password string) (string, error) {
 	return string(bytes), err
 }
 
+// Session is a login, either of an admin User or of a Player, identified by
+// the token in its cookie.
 type Session struct {
 	Id     int
 	Token  string
 	User   *User
+	Player *Player
 	Expiry time.Time
 }
 
+// PlayerSessionCookie holds the token of a player's session, kept apart from
+// the admin session so that logging in as one doesn't affect the other.
+// AnonymousPlayerCookie holds a long lived session for an anonymous player,
+// which identifies players who haven't logged in.
+const (
+	PlayerSessionCookie   = "player_session"
+	AnonymousPlayerCookie = "anonymous_player"
+)
+
 func (s *Session) IsExpired() bool {
 	return s.Expiry.Before(time.Now().UTC())
 }
@@ -77,11 +89,57 @@ func GetSession(r *http.Request) *Session {
 	return &session
 }
 
+// GetPlayerSession returns the logged in player's session, if any.
+func GetPlayerSession(r *http.Request) *Session {
+	return getPlayerSession(r, PlayerSessionCookie)
+}
+
+// GetAnonymousSession returns the session identifying an anonymous player,
+// if any.
+func GetAnonymousSession(r *http.Request) *Session {
+	return getPlayerSession(r, AnonymousPlayerCookie)
+}
+
+func getPlayerSession(r *http.Request, cookie string) *Session {
+	c, err := r.Cookie(cookie)
+	if err != nil {
+		return nil
+	}
+	session := Session{
+		Player: &Player{},
+	}
+	row := db.Pool.QueryRow(context.Background(),
+		`
+			SELECT sessions.id, sessions.expiry, players.id, COALESCE(players.username, ''), players.created_at
+			FROM sessions
+			JOIN players ON sessions.player_id = players.id
+			WHERE sessions.token = $1
+		`,
+		c.Value,
+	)
+	err = row.Scan(&session.Id, &session.Expiry, &session.Player.Id, &session.Player.Username, &session.Player.CreatedAt)
+	if err != nil {
+		return nil
+	}
+	if session.IsExpired() {
+		session.Delete()
+		return nil
+	}
+	return &session
+}
+
 func (s *Session) Save() error {
+	var userId, playerId *int
+	if s.User != nil {
+		userId = &s.User.Id
+	}
+	if s.Player != nil {
+		playerId = &s.Player.Id
+	}
 	row := db.Pool.QueryRow(
 		context.Background(),
-		"INSERT INTO sessions (token, expiry, user_id) VALUES ($1, $2, $3) RETURNING id",
-		s.Token, s.Expiry, s.User.Id,
+		"INSERT INTO sessions (token, expiry, user_id, player_id) VALUES ($1, $2, $3, $4) RETURNING id",
+		s.Token, s.Expiry, userId, playerId,
 	)
 	return row.Scan(&s.Id)
 }
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Storage saves and retrieves uploaded files by key.
+type Storage interface {
+	// Save stores the contents of r under a new key ending in ext and returns
+	// the key.
+	Save(r io.Reader, ext string) (string, error)
+	Open(key string) (io.ReadSeekCloser, error)
+	Delete(key string) error
+}
+
+// Default is the storage used for question and choice images.
+var Default Storage
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// LocalStorage keeps files in a directory on the local disk.
+type LocalStorage struct {
+	Dir string
+}
+
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalStorage{Dir: dir}, nil
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || strings.HasPrefix(key, ".") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.Dir, key), nil
+}
+
+func (s *LocalStorage) Save(r io.Reader, ext string) (string, error) {
+	key := uuid.New().String() + ext
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, r)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return key, nil
+}
+
+func (s *LocalStorage) Open(key string) (io.ReadSeekCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,34 @@
+package utils
+
+// Levenshtein returns the number of single-character insertions, deletions
+// and substitutions needed to turn a into b.
+func Levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	curr := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		curr[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(t)]
+}
+
+func minInt(first int, rest ...int) int {
+	m := first
+	for _, n := range rest {
+		if n < m {
+			m = n
+		}
+	}
+	return m
+}
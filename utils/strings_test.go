@@ -0,0 +1,30 @@
+package utils
+
+import "testing"
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"paris", "paris", 0},
+		{"iran", "iraq", 1},
+		{"beatles", "beatls", 1},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"madrid", "mardid", 2},
+		{"café", "cafe", 1},
+		{"pokémon", "pokemon", 1},
+	}
+	for _, tt := range tests {
+		if got := Levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("Levenshtein(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := Levenshtein(tt.b, tt.a); got != tt.want {
+			t.Errorf("Levenshtein(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}